@@ -0,0 +1,54 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+	"time"
+
+	"github.com/tomtau/tmkms-threshold/internal/mocknode"
+)
+
+// mocknode listens like a Tendermint node with priv_validator_laddr set, waits for the signer
+// to connect and checks its replies to a scripted stream of requests, see mocknode.DefaultScript
+func main() {
+	listen := flag.String("listen", "tcp://127.0.0.1:26659", "address the signer dials, as in the signer's [[node]] address")
+	chainID := flag.String("chain-id", "", "chain ID the signer signs for")
+	heights := flag.Int("heights", 10, "number of heights to sign")
+	timeout := flag.Duration("timeout", time.Minute, "how long to wait for the signer to connect and for each reply")
+	flag.Parse()
+	if *chainID == "" {
+		log.Fatal("--chain-id is required")
+	}
+	if err := run(*listen, *chainID, *heights, *timeout); err != nil {
+		log.Fatal(err)
+	}
+}
+
+func run(listen string, chainID string, heights int, timeout time.Duration) error {
+	dir, err := ioutil.TempDir("", "mocknode")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(dir)
+	node, err := mocknode.Listen(mocknode.Options{
+		Address: listen,
+		ChainID: chainID,
+		Dir:     dir,
+		Timeout: timeout,
+	})
+	if err != nil {
+		return err
+	}
+	defer node.Close()
+
+	fmt.Printf("waiting for the signer on %s\n", node.Address())
+	report := node.Run(mocknode.DefaultScript(heights))
+	fmt.Print(report)
+	if !report.OK() {
+		return fmt.Errorf("the signer does not behave like FilePV")
+	}
+	return nil
+}
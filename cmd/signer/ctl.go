@@ -0,0 +1,86 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"time"
+
+	internalSigner "github.com/tomtau/tmkms-threshold/internal/signer"
+)
+
+const ctlUsage = "usage: ctl (status|pause [chain_id]|resume [chain_id]|reconnect-node <address>|reconnect-peer <id>|reload)"
+
+// ctl is the client of the admin API of a running signer
+func ctl(config internalSigner.CoConfig, args []string) error {
+	if config.AdminSocket == "" {
+		return fmt.Errorf("admin_socket is not set in the config")
+	}
+	if len(args) == 0 {
+		return fmt.Errorf(ctlUsage)
+	}
+	arg := func(i int) string {
+		if len(args) > i {
+			return args[i]
+		}
+		return ""
+	}
+
+	method := http.MethodPost
+	query := url.Values{}
+	var path string
+	switch args[0] {
+	case "status":
+		method = http.MethodGet
+		path = "/status"
+	case "pause", "resume":
+		path = "/" + args[0]
+		if chainID := arg(1); chainID != "" {
+			query.Set("chain_id", chainID)
+		}
+	case "reconnect-node":
+		path = "/reconnect/node"
+		query.Set("address", arg(1))
+	case "reconnect-peer":
+		path = "/reconnect/peer"
+		query.Set("id", arg(1))
+	case "reload":
+		path = "/reload"
+	default:
+		return fmt.Errorf(ctlUsage)
+	}
+
+	client := http.Client{
+		Timeout: 30 * time.Second,
+		Transport: &http.Transport{
+			DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+				var dialer net.Dialer
+				return dialer.DialContext(ctx, "unix", config.AdminSocket)
+			},
+		},
+	}
+	// the host is ignored when dialing the socket
+	reqURL := url.URL{Scheme: "http", Host: "signer", Path: path, RawQuery: query.Encode()}
+	req, err := http.NewRequest(method, reqURL.String(), nil)
+	if err != nil {
+		return err
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+	os.Stdout.Write(body)
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("admin request failed: %s", resp.Status)
+	}
+	return nil
+}
@@ -0,0 +1,152 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"text/template"
+
+	internalSigner "github.com/tomtau/tmkms-threshold/internal/signer"
+)
+
+const configTemplate = `# tmkms-threshold cosigner configuration
+
+# ID of this cosigner, between 1 and the number of cosigners
+cosigner_id = {{.CosignerId}}
+# number of peer cosigners that sign together with this one:
+# cosigner_threshold + 1 cosigners are needed for a signature
+cosigner_threshold = {{.CosignerThreshold}}
+# address the peer cosigners connect to
+cosigner_listen_address = "{{.ListenAddress}}"
+# how long a signing session may take
+session_timeout_sec = {{.SessionTimeoutSec}}
+
+# used by the keygen command only
+keygen_proxy_pub = "{{.KeygenProxyPub}}"
+keygen_proxy_sub = "{{.KeygenProxySub}}"
+
+# optional: serve /metrics, /healthz and /readyz over HTTP
+# http_listen_address = "127.0.0.1:26680"
+# optional: append a JSON audit log of signing decisions
+# audit_log_file = "audit.log"
+# optional: serve the admin API used by the ctl command on a Unix socket
+# admin_socket = "signer.sock"
+# optional: timeouts of the connections to the nodes; a connection without
+# a request for idle_timeout_sec is dialed again
+# [node_connection]
+# dial_timeout_sec = 30
+# write_timeout_sec = 5
+# idle_timeout_sec = 30
+# keepalive_sec = 15
+# optional: backoff between the attempts to reconnect to a node or a peer cosigner
+# [reconnect]
+# initial_delay_ms = 500
+# max_delay_ms = 30000
+# multiplier = 2
+# jitter = 0.2
+# optional, staging only: inject faults into the requests to the peers (id 0 for all)
+# and the replies to the nodes ([[chaos.node]] with an address, empty for all)
+# [chaos]
+# enabled = true
+# [[chaos.peer]]
+# id = 0
+# drop_reply = 0.05
+# delay = 0.2
+# delay_min_ms = 10
+# delay_max_ms = 500
+
+# the chain to sign for; more chains can be added with [[chain]] blocks
+# holding chain_id, key_share_file, state_file and [[chain.node]] entries
+chain_id = "{{.ChainID}}"
+# key share written by the keygen command
+key_share_file = "{{.KeySharePath}}"
+# last signed height, round and step; never share it between chains or cosigners
+state_file = "{{.PrivValStateFile}}"
+{{range .Nodes}}
+# Tendermint node to sign for, listening with priv_validator_laddr
+[[node]]
+address = "{{.Address}}"
+{{end}}{{range .Cosigners}}
+# peer cosigner
+[[cosigner]]
+id = {{.ID}}
+remote_address = "{{.Address}}"
+{{end}}`
+
+type stringList []string
+
+func (list *stringList) String() string {
+	return strings.Join(*list, ",")
+}
+
+func (list *stringList) Set(value string) error {
+	*list = append(*list, value)
+	return nil
+}
+
+// initConfig writes a template config for a cosigner to path
+func initConfig(path string, args []string) error {
+	flags := flag.NewFlagSet("init", flag.ContinueOnError)
+	cosignerID := flags.Uint("cosigner-id", 0, "ID of this cosigner")
+	threshold := flags.Uint("threshold", 0, "number of peers signing together with this cosigner")
+	listen := flags.String("listen", "tcp://0.0.0.0:26660", "address the peer cosigners connect to")
+	chainID := flags.String("chain-id", "", "chain ID to sign for")
+	var peers, nodes stringList
+	flags.Var(&peers, "peer", "peer cosigner as id@address (repeatable)")
+	flags.Var(&nodes, "node", "address of a Tendermint node (repeatable)")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if *chainID == "" {
+		return fmt.Errorf("-chain-id is required")
+	}
+	if *cosignerID > 255 || *threshold > 255 {
+		return fmt.Errorf("cosigner-id and threshold must be below 256")
+	}
+
+	config := internalSigner.CoConfig{
+		CosignerId:        byte(*cosignerID),
+		CosignerThreshold: byte(*threshold),
+		ListenAddress:     *listen,
+		SessionTimeoutSec: 5,
+		KeygenProxyPub:    "tcp://127.0.0.1:5555",
+		KeygenProxySub:    "tcp://127.0.0.1:5556",
+		ChainID:           *chainID,
+		KeySharePath:      "share.json",
+		PrivValStateFile:  "state.json",
+	}
+	for _, peer := range peers {
+		parts := strings.SplitN(peer, "@", 2)
+		if len(parts) != 2 {
+			return fmt.Errorf("invalid peer %q, expected id@address", peer)
+		}
+		id, err := strconv.Atoi(parts[0])
+		if err != nil {
+			return fmt.Errorf("invalid peer %q: %w", peer, err)
+		}
+		config.Cosigners = append(config.Cosigners, internalSigner.CosignerConfig{ID: id, Address: parts[1]})
+	}
+	for _, node := range nodes {
+		config.Nodes = append(config.Nodes, internalSigner.NodeConfig{Address: node})
+	}
+	if err := config.Validate(); err != nil {
+		return err
+	}
+
+	tmpl, err := template.New("config").Parse(configTemplate)
+	if err != nil {
+		return err
+	}
+	// never overwrite an existing config
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0600)
+	if err != nil {
+		return err
+	}
+	if err := tmpl.Execute(file, config); err != nil {
+		file.Close()
+		return err
+	}
+	return file.Close()
+}
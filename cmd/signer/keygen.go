@@ -17,7 +17,7 @@ import (
 	internalSigner "github.com/tomtau/tmkms-threshold/internal/signer"
 )
 
-func keygen(config internalSigner.CoConfig, logger tmlog.Logger) {
+func keygen(config internalSigner.CoConfig, chain internalSigner.ChainConfig, logger tmlog.Logger) {
 	n := len(config.Cosigners) + 1
 	partySet := helpers.GenerateSet(party.ID(n))
 	state, output, err := frost.NewKeygenState(party.ID(config.CosignerId), partySet, party.Size(config.CosignerThreshold), 0)
@@ -220,11 +220,11 @@ func keygen(config internalSigner.CoConfig, logger tmlog.Logger) {
 		return
 	}
 
-	_ = ioutil.WriteFile(config.KeySharePath, jsonData, 0644)
+	_ = ioutil.WriteFile(chain.KeySharePath, jsonData, 0644)
 	logger.Info(
 		"Tendermint Validator",
 		"Success: output written to",
-		config.KeySharePath,
+		chain.KeySharePath,
 	)
 
 }
@@ -35,35 +35,90 @@ func main() {
 
 	var configFile = flag.String("config", "", "path to configuration file")
 	var pubkeyhrp = flag.String("pubkeyhrp", "", "pubkey bech32 prefix (if any)")
+	var chainID = flag.String("chain", "", "chain ID for keygen, test-sign and print-pubkey (if more than one chain is configured)")
 
 	flag.Parse()
 	var command = flag.Arg(0)
 
+	if command == "" {
+		panic("missing command (init|validate-config|keygen|sign|test-sign|status|print-pubkey|ctl|simulate)")
+	}
+	// simulate needs no config
+	if command == "simulate" {
+		if err := simulate(flag.Args()[1:]); err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
 	if *configFile == "" {
 		panic("--config flag is required")
 	}
-	if command == "" {
-		panic("missing command (keygen|sign)")
+
+	if command == "init" {
+		if err := initConfig(*configFile, flag.Args()[1:]); err != nil {
+			log.Fatal(err)
+		}
+		fmt.Printf("wrote %s\n", *configFile)
+		return
 	}
 
 	config, err := internalSigner.LoadConfigFromFile(*configFile)
 	if err != nil {
 		log.Fatal(err)
 	}
+	if command == "validate-config" {
+		if err := config.Validate(); err != nil {
+			log.Fatal(err)
+		}
+		fmt.Println("config is valid")
+		return
+	}
+	if command == "sign" || command == "keygen" || command == "test-sign" {
+		if err := config.Validate(); err != nil {
+			log.Fatal(err)
+		}
+	}
 
-	logger.Info(
-		"Tendermint Validator",
-		"p2p priv-key", config.KeySharePath,
-		"priv-state-dir", config.PrivValStateFile,
-	)
+	for _, chain := range config.ChainConfigs() {
+		logger.Info(
+			"Tendermint Validator",
+			"chain_id", chain.ChainID,
+			"p2p priv-key", chain.KeySharePath,
+			"priv-state-dir", chain.PrivValStateFile,
+		)
+	}
 
 	switch command {
 	case "sign":
-		signer(config, logger)
+		signer(*configFile, config, logger)
+	case "ctl":
+		if err := ctl(config, flag.Args()[1:]); err != nil {
+			log.Fatal(err)
+		}
+	case "status":
+		if err := status(config); err != nil {
+			log.Fatal(err)
+		}
+	case "test-sign":
+		chain, err := config.FindChain(*chainID)
+		if err != nil {
+			log.Fatal(err)
+		}
+		if err := testSign(config, chain); err != nil {
+			log.Fatal(err)
+		}
 	case "keygen":
-		keygen(config, logger)
+		chain, err := config.FindChain(*chainID)
+		if err != nil {
+			log.Fatal(err)
+		}
+		keygen(config, chain, logger)
 	case "print-pubkey":
-		kgOutput, err := internalSigner.LoadKeygenOutputFromFile(config.KeySharePath)
+		chain, err := config.FindChain(*chainID)
+		if err != nil {
+			log.Fatal(err)
+		}
+		kgOutput, err := internalSigner.LoadKeygenOutputFromFile(chain.KeySharePath)
 		if err != nil {
 			log.Fatal(err)
 		}
@@ -1,39 +1,68 @@
 package main
 
 import (
+	"context"
 	"log"
-	"net"
+	"os"
+	"os/signal"
 	"sync"
+	"syscall"
 	"time"
 
 	tmlog "github.com/tendermint/tendermint/libs/log"
 	tmOS "github.com/tendermint/tendermint/libs/os"
 	tmService "github.com/tendermint/tendermint/libs/service"
-	"github.com/tendermint/tendermint/types"
 	internalSigner "github.com/tomtau/tmkms-threshold/internal/signer"
 )
 
-func signer(config internalSigner.CoConfig, logger tmlog.Logger) {
+const (
+	// how long the signing rounds in progress are waited for on shutdown
+	drainTimeout = 5 * time.Second
+	// the process exits with an error if shutting down takes longer than this
+	shutdownTimeout = 15 * time.Second
+)
+
+func signer(configFile string, config internalSigner.CoConfig, logger tmlog.Logger) {
 	// services to stop on shutdown
 	var services []tmService.Service
 
-	var pv types.PrivValidator
+	chains := config.ChainConfigs()
+	if len(chains) == 0 {
+		log.Fatal("chain_id option or a [[chain]] block is required")
+	}
 
-	chainID := config.ChainID
-	if chainID == "" {
-		log.Fatal("chain_id option is required")
+	if config.Chaos.Enabled {
+		logger.Error("Chaos mode is enabled: faults are injected into the connections to the peers and nodes")
 	}
 
-	local, err := internalSigner.NewLocalCosigner(config)
+	shutdownTracing, err := internalSigner.SetupTracing(config.Tracing, config.CosignerId)
 	if err != nil {
-		panic(err)
+		log.Fatal(err)
 	}
-	remote, err := internalSigner.NewRemoteCosigners(config)
-	if err != nil {
-		panic(err)
+
+	var audit *internalSigner.AuditLog
+	if config.AuditLogFile != "" {
+		var err error
+		audit, err = internalSigner.OpenAuditLog(config.AuditLogFile)
+		if err != nil {
+			log.Fatal(err)
+		}
+	}
+
+	locals := make([]*internalSigner.LocalCosigner, 0, len(chains))
+	for _, chain := range chains {
+		if chain.ChainID == "" {
+			log.Fatal("chain_id option is required")
+		}
+		local, err := internalSigner.NewLocalCosigner(config, chain)
+		if err != nil {
+			panic(err)
+		}
+		local.SetAuditLog(audit)
+		locals = append(locals, local)
 	}
 
-	signerServer, err := internalSigner.NewSignerServer(logger, local, config)
+	signerServer, err := internalSigner.NewSignerServer(logger, locals, config)
 	if err != nil {
 		panic(err)
 	}
@@ -44,36 +73,110 @@ func signer(config internalSigner.CoConfig, logger tmlog.Logger) {
 
 	services = append(services, signerServer)
 
-	val := internalSigner.NewThresholdValidator(local, remote)
-	pv = &internalSigner.PvGuard{PrivValidator: val}
+	signerChains := make([]*internalSigner.Chain, 0, len(chains))
+	for i, chainConfig := range chains {
+		chain, err := internalSigner.NewChain(logger, config, locals[i], audit)
+		if err != nil {
+			panic(err)
+		}
 
-	pubkey, err := pv.GetPubKey()
-	if err != nil {
-		log.Fatal(err)
+		pubkey, err := chain.PrivValidator.GetPubKey()
+		if err != nil {
+			log.Fatal(err)
+		}
+		logger.Info("Signer", "chain_id", chain.ChainID(), "pubkey", pubkey)
+
+		for _, node := range chainConfig.Nodes {
+			if err := chain.AddNode(node.Address); err != nil {
+				panic(err)
+			}
+		}
+		signerChains = append(signerChains, chain)
 	}
-	logger.Info("Signer", "pubkey", pubkey)
 
-	for _, node := range config.Nodes {
-		dialer := net.Dialer{Timeout: 30 * time.Second}
-		signer := internalSigner.NewReconnRemoteSigner(node.Address, logger, config.ChainID, pv, dialer)
+	reloader := internalSigner.NewReloader(logger, configFile, config, signerChains)
+	health := internalSigner.NewHealthChecker(signerChains)
+	admin := internalSigner.NewAdmin(signerChains, reloader.Reload)
 
-		err := signer.Start()
+	if config.HttpListenAddress != "" {
+		httpServer := internalSigner.NewHttpServer(logger, "tcp", config.HttpListenAddress)
+		internalSigner.RegisterMetrics(httpServer.Mux)
+		health.Register(httpServer.Mux)
+		err = httpServer.Start()
 		if err != nil {
 			panic(err)
 		}
+		services = append(services, httpServer)
+	}
 
-		services = append(services, signer)
+	if config.AdminSocket != "" {
+		adminServer := internalSigner.NewHttpServer(logger, "unix", config.AdminSocket)
+		admin.Register(adminServer.Mux)
+		err = adminServer.Start()
+		if err != nil {
+			panic(err)
+		}
+		services = append(services, adminServer)
 	}
 
+	// reload the config on SIGHUP, until the shutdown begins
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+	stopReloading := make(chan struct{})
+	reloadingStopped := make(chan struct{})
+	go func() {
+		defer close(reloadingStopped)
+		for {
+			select {
+			case <-hup:
+				if err := reloader.Reload(); err != nil {
+					logger.Error("Reloading config", "err", err)
+				}
+			case <-stopReloading:
+				return
+			}
+		}
+	}()
+
 	wg := sync.WaitGroup{}
 	wg.Add(1)
 	tmOS.TrapSignal(logger, func() {
+		// a component that does not stop must not keep the process alive
+		timer := time.AfterFunc(shutdownTimeout, func() {
+			logger.Error("Shutdown timed out", "timeout", shutdownTimeout)
+			os.Exit(1)
+		})
+		defer timer.Stop()
+
+		// a reload in progress finishes before the chains it changes are stopped
+		signal.Stop(hup)
+		close(stopReloading)
+		<-reloadingStopped
+
+		// the chains drain their signing rounds while the signer server still serves the peers
+		ctx, cancel := context.WithTimeout(context.Background(), drainTimeout)
+		defer cancel()
+		for _, chain := range signerChains {
+			if err := chain.Stop(ctx); err != nil {
+				logger.Error("Stopping chain", "chain_id", chain.ChainID(), "err", err)
+			}
+		}
 		for _, service := range services {
-			err := service.Stop()
-			if err != nil {
-				panic(err)
+			if err := service.Stop(); err != nil {
+				logger.Error("Stopping service", "service", service.String(), "err", err)
+			}
+		}
+		for _, local := range locals {
+			if err := local.Close(); err != nil {
+				logger.Error("Saving sign state", "chain_id", local.ChainID(), "err", err)
 			}
 		}
+		if err := audit.Close(); err != nil {
+			logger.Error("Closing audit log", "err", err)
+		}
+		if err := shutdownTracing(context.Background()); err != nil {
+			logger.Error("Flushing traces", "err", err)
+		}
 		wg.Done()
 	})
 	wg.Wait()
@@ -0,0 +1,51 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+
+	tmlog "github.com/tendermint/tendermint/libs/log"
+	"github.com/tomtau/tmkms-threshold/internal/simulator"
+)
+
+// simulate runs a cluster of cosigners on loopback and signs a scripted stream of votes
+// and proposals with it, see simulator.DefaultScript
+func simulate(args []string) error {
+	flags := flag.NewFlagSet("simulate", flag.ContinueOnError)
+	cosigners := flags.Int("cosigners", 3, "number of cosigners")
+	threshold := flags.Int("threshold", 1, "number of peers signing together with each cosigner")
+	heights := flags.Int("heights", 10, "number of heights to sign")
+	chainID := flags.String("chain-id", "simulator", "chain ID to sign for")
+	dir := flags.String("dir", "", "directory to keep the key shares and sign states in (a temporary one if empty)")
+	verbose := flags.Bool("verbose", false, "log the cosigners")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+
+	logger := tmlog.NewNopLogger()
+	if *verbose {
+		logger = tmlog.NewTMLogger(tmlog.NewSyncWriter(os.Stdout))
+	}
+	cluster, err := simulator.NewCluster(simulator.Options{
+		Cosigners: *cosigners,
+		Threshold: *threshold,
+		ChainID:   *chainID,
+		Dir:       *dir,
+		Logger:    logger,
+	})
+	if err != nil {
+		return err
+	}
+	defer cluster.Stop()
+
+	fmt.Printf("chain:     %s\n", cluster.ChainID)
+	fmt.Printf("pubkey:    %v\n", cluster.PubKey)
+	fmt.Printf("cosigners: %d, %d signing\n", *cosigners, *threshold+1)
+	report := cluster.Run(simulator.DefaultScript(*heights))
+	fmt.Print(report)
+	if !report.OK() {
+		return fmt.Errorf("simulation failed")
+	}
+	return nil
+}
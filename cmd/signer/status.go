@@ -0,0 +1,97 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"text/tabwriter"
+	"time"
+
+	internalSigner "github.com/tomtau/tmkms-threshold/internal/signer"
+)
+
+// how long status waits for each cosigner and node
+const statusTimeout = 3 * time.Second
+
+// status prints the reachability of the cosigners and nodes in the config
+func status(config internalSigner.CoConfig) error {
+	peers, err := internalSigner.NewRemoteCosigners(config)
+	if err != nil {
+		return err
+	}
+	if err := peers.Start(); err != nil {
+		return err
+	}
+	defer peers.Stop()
+
+	type nodeResult struct {
+		chainID string
+		address string
+		probe   internalSigner.NodeProbe
+	}
+	var nodes []nodeResult
+	for _, chain := range config.ChainConfigs() {
+		for _, node := range chain.Nodes {
+			nodes = append(nodes, nodeResult{chainID: chain.ChainID, address: node.Address})
+		}
+	}
+
+	// probe the nodes while the cosigners are pinged
+	var wg sync.WaitGroup
+	for i := range nodes {
+		wg.Add(1)
+		go func(node *nodeResult) {
+			defer wg.Done()
+			node.probe = internalSigner.ProbeNode(node.address, statusTimeout)
+		}(&nodes[i])
+	}
+	pings := peers.PingDetails(statusTimeout)
+	wg.Wait()
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "COSIGNER\tADDRESS\tREACHABLE\tRTT\tVERSION\tLAST SIGNED (CHAIN HEIGHT/ROUND/STEP)")
+	addresses := make(map[byte]string, len(config.Cosigners))
+	ids := make([]int, 0, len(config.Cosigners))
+	for _, cosigner := range config.Cosigners {
+		addresses[byte(cosigner.ID)] = cosigner.Address
+		ids = append(ids, cosigner.ID)
+	}
+	sort.Ints(ids)
+	for _, id := range ids {
+		ping := pings[byte(id)]
+		if ping.Err != nil {
+			fmt.Fprintf(w, "%d\t%s\tno\t-\t-\t%v\n", id, addresses[byte(id)], ping.Err)
+			continue
+		}
+		version := "-"
+		if ping.Pong.Version > 0 {
+			version = fmt.Sprint(ping.Pong.Version)
+		}
+		hrs := make([]string, 0, len(ping.Pong.Chains))
+		for _, chain := range ping.Pong.Chains {
+			hrs = append(hrs, fmt.Sprintf("%s %d/%d/%d", chain.ChainID, chain.Height, chain.Round, chain.Step))
+		}
+		fmt.Fprintf(w, "%d\t%s\tyes\t%s\t%s\t%s\n", id, addresses[byte(id)], formatRTT(ping.RTT), version, strings.Join(hrs, ", "))
+	}
+
+	fmt.Fprintln(w, "\nNODE\tCHAIN\tREACHABLE\tRTT\tPRIVVAL HANDSHAKE")
+	for _, node := range nodes {
+		probe := node.probe
+		switch {
+		case !probe.Reachable:
+			fmt.Fprintf(w, "%s\t%s\tno\t-\t%v\n", node.address, node.chainID, probe.Err)
+		case probe.Handshake:
+			fmt.Fprintf(w, "%s\t%s\tyes\t%s\tok (no signer connected)\n", node.address, node.chainID, formatRTT(probe.RTT))
+		default:
+			// nodes only accept a handshake while no signer is connected
+			fmt.Fprintf(w, "%s\t%s\tyes\t%s\tnot accepted (signer connected?): %v\n", node.address, node.chainID, formatRTT(probe.RTT), probe.Err)
+		}
+	}
+	return w.Flush()
+}
+
+func formatRTT(rtt time.Duration) string {
+	return rtt.Round(time.Microsecond).String()
+}
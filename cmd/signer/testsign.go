@@ -0,0 +1,91 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"text/tabwriter"
+	"time"
+
+	tmProto "github.com/tendermint/tendermint/proto/tendermint/types"
+	tm "github.com/tendermint/tendermint/types"
+	internalSigner "github.com/tomtau/tmkms-threshold/internal/signer"
+)
+
+// testSign produces a threshold signature of a synthetic vote with the cosigners of the chain.
+// The vote is for the test chain ID of the chain, which the cosigners sign with
+// dry-run cosigners, so the sign state of the chain is not touched.
+func testSign(config internalSigner.CoConfig, chain internalSigner.ChainConfig) error {
+	local, err := internalSigner.NewDryRunCosigner(config, chain)
+	if err != nil {
+		return err
+	}
+	peers, err := internalSigner.NewRemoteCosigners(config)
+	if err != nil {
+		return err
+	}
+	if err := peers.Start(); err != nil {
+		return err
+	}
+	defer peers.Stop()
+	val := internalSigner.NewThresholdValidator(local, peers)
+	pubkey, err := val.GetPubKey()
+	if err != nil {
+		return err
+	}
+
+	chainID := internalSigner.TestSignChainID(chain.ChainID)
+	now := time.Now()
+	vote := &tmProto.Vote{
+		Type: tmProto.PrevoteType,
+		// the dry-run cosigners of the peers keep their sign state while they run,
+		// so every test needs a higher height
+		Height:    now.UnixNano(),
+		Round:     0,
+		Timestamp: now,
+	}
+	start := time.Now()
+	err = val.SignVote(chainID, vote)
+	elapsed := time.Since(start)
+
+	fmt.Printf("chain:     %s\n", chainID)
+	fmt.Printf("pubkey:    %v\n", pubkey)
+	fmt.Printf("duration:  %v\n", elapsed)
+	printLatencies(peers.Latencies())
+	if err != nil {
+		return fmt.Errorf("signing failed: %w", err)
+	}
+	if !pubkey.VerifySignature(tm.VoteSignBytes(chainID, vote), vote.Signature) {
+		return fmt.Errorf("signature does not verify against the group key")
+	}
+	fmt.Println("signature: OK")
+	return nil
+}
+
+func printLatencies(latencies map[byte]map[string]time.Duration) {
+	ids := make([]int, 0, len(latencies))
+	for id := range latencies {
+		ids = append(ids, int(id))
+	}
+	sort.Ints(ids)
+	w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "\nPEER\tSIGN\tSTART SESSION\tEND SESSION\tSET SIGNATURE")
+	for _, id := range ids {
+		requests := latencies[byte(id)]
+		fmt.Fprintf(w, "%d\t%s\t%s\t%s\t%s\n", id,
+			formatLatency(requests, "sign"),
+			formatLatency(requests, "start_session"),
+			formatLatency(requests, "end_session"),
+			formatLatency(requests, "set_signature"))
+	}
+	w.Flush()
+	fmt.Println()
+}
+
+func formatLatency(requests map[string]time.Duration, request string) string {
+	latency, ok := requests[request]
+	if !ok {
+		return "-"
+	}
+	return latency.Round(time.Microsecond).String()
+}
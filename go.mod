@@ -3,10 +3,17 @@ module github.com/tomtau/tmkms-threshold
 go 1.16
 
 require (
+	filippo.io/edwards25519 v1.0.0-beta.3
 	github.com/BurntSushi/toml v0.3.1
 	github.com/enigmampc/btcutil v1.0.3-0.20200723161021-e2fb6adb2a25
 	github.com/gogo/protobuf v1.3.2
 	github.com/pebbe/zmq4 v1.2.7
+	github.com/prometheus/client_golang v1.11.0
 	github.com/taurusgroup/frost-ed25519 v0.0.0-20210314175854-e298dd22e838
 	github.com/tendermint/tendermint v0.34.10
+	go.opentelemetry.io/otel v1.0.1
+	go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracegrpc v1.0.1
+	go.opentelemetry.io/otel/exporters/stdout/stdouttrace v1.0.1
+	go.opentelemetry.io/otel/sdk v1.0.1
+	go.opentelemetry.io/otel/trace v1.0.1
 )
@@ -0,0 +1,97 @@
+package mocknode_test
+
+import (
+	"net"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	tmLog "github.com/tendermint/tendermint/libs/log"
+	"github.com/tomtau/tmkms-threshold/internal/mocknode"
+	internalSigner "github.com/tomtau/tmkms-threshold/internal/signer"
+	"github.com/tomtau/tmkms-threshold/internal/simulator"
+)
+
+func TestDefaultScript(t *testing.T) {
+	cluster := simulator.Start(t, 3, 1)
+	node := mocknode.StartWith(t, mocknode.Options{
+		ChainID: cluster.ChainID,
+		PubKey:  cluster.PubKey,
+	})
+	chain := cluster.Cosigner(1).Chain
+	if err := chain.AddNode(node.Address()); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		chain.StopNodes()
+	})
+
+	report := mocknode.RunScript(t, node, mocknode.DefaultScript(3))
+	t.Log(report)
+}
+
+// connectionEvents returns how many times the event happened on the connections to the node
+func connectionEvents(t *testing.T, node *mocknode.Node, event string) float64 {
+	t.Helper()
+	families, err := prometheus.DefaultGatherer.Gather()
+	if err != nil {
+		t.Fatal(err)
+	}
+	total := 0.0
+	for _, family := range families {
+		if family.GetName() != "tmkms_node_connection_events_total" {
+			continue
+		}
+		for _, metric := range family.GetMetric() {
+			labels := map[string]string{}
+			for _, label := range metric.GetLabel() {
+				labels[label.GetName()] = label.GetValue()
+			}
+			if labels["node"] == node.Address() && labels["event"] == event {
+				total += metric.GetCounter().GetValue()
+			}
+		}
+	}
+	return total
+}
+
+func TestIdleTimeout(t *testing.T) {
+	cluster := simulator.Start(t, 3, 1)
+	node := mocknode.StartWith(t, mocknode.Options{
+		ChainID: cluster.ChainID,
+		PubKey:  cluster.PubKey,
+		Timeout: 5 * time.Second,
+	})
+	signer := internalSigner.NewReconnRemoteSigner(node.Address(), tmLog.NewNopLogger(), cluster.ChainID,
+		cluster.Cosigner(1).Chain.PrivValidator, net.Dialer{Timeout: time.Second})
+	signer.SetTimeouts(time.Second, 200*time.Millisecond)
+	if err := signer.Start(); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		signer.Stop()
+	})
+
+	// the node accepts the connection, then stays silent past the idle timeout
+	if err := node.Accept(); err != nil {
+		t.Fatal(err)
+	}
+	start := time.Now()
+
+	// the signer drops it and redials
+	if err := node.Accept(); err != nil {
+		t.Fatalf("the signer did not redial: %v", err)
+	}
+	if elapsed := time.Since(start); elapsed < 200*time.Millisecond {
+		t.Errorf("the signer redialed after %v, before the idle timeout", elapsed)
+	}
+	if n := connectionEvents(t, node, "idle_timeout"); n == 0 {
+		t.Error("no idle timeout counted")
+	}
+
+	// and signs on the new connection
+	report := mocknode.RunScript(t, node, mocknode.DefaultScript(1))
+	if len(report.Results) == 0 {
+		t.Error("no request was sent")
+	}
+}
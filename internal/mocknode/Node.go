@@ -0,0 +1,140 @@
+// Package mocknode plays the part of a Tendermint node towards a remote signer:
+// it listens for the signer with a SecretConnection, sends it a scripted sequence
+// of privval requests and checks the replies against the semantics of Tendermint's
+// own FilePV, which signs the same requests alongside for reference.
+package mocknode
+
+import (
+	"fmt"
+	"net"
+	"path/filepath"
+	"time"
+
+	"github.com/tendermint/tendermint/crypto"
+	tmCryptoEd2219 "github.com/tendermint/tendermint/crypto/ed25519"
+	tmNet "github.com/tendermint/tendermint/libs/net"
+	tmP2pConn "github.com/tendermint/tendermint/p2p/conn"
+	"github.com/tendermint/tendermint/privval"
+	tmProtoPrivval "github.com/tendermint/tendermint/proto/tendermint/privval"
+	internalSigner "github.com/tomtau/tmkms-threshold/internal/signer"
+)
+
+// Options describe the mock node
+type Options struct {
+	// address to listen on for the signer, e.g. tcp://127.0.0.1:26659;
+	// a free loopback port if empty
+	Address string
+	ChainID string
+	// directory for the key and sign state of the reference FilePV
+	Dir string
+	// public key the signer must report; any key if nil
+	PubKey crypto.PubKey
+	// how long to wait for the signer to connect and for each reply, 10s if 0
+	Timeout time.Duration
+}
+
+// Node is a mock Tendermint node waiting for a remote signer to connect
+type Node struct {
+	ChainID string
+
+	listener net.Listener
+	privKey  tmCryptoEd2219.PrivKey
+	timeout  time.Duration
+	conn     net.Conn
+
+	// FilePV signing every request alongside the signer, deciding the expected outcome
+	reference *privval.FilePV
+	// the public key reported by the signer
+	pubKey crypto.PubKey
+	// signatures of the signer by sign bytes
+	signed map[string][]byte
+}
+
+// Listen starts listening for the signer
+func Listen(opts Options) (*Node, error) {
+	if opts.ChainID == "" {
+		return nil, fmt.Errorf("no chain ID")
+	}
+	if opts.Dir == "" {
+		return nil, fmt.Errorf("no directory for the reference FilePV")
+	}
+	if opts.Address == "" {
+		opts.Address = "tcp://127.0.0.1:0"
+	}
+	if opts.Timeout == 0 {
+		opts.Timeout = 10 * time.Second
+	}
+	proto, address := tmNet.ProtocolAndAddress(opts.Address)
+	listener, err := net.Listen(proto, address)
+	if err != nil {
+		return nil, err
+	}
+	reference := privval.GenFilePV(
+		filepath.Join(opts.Dir, "reference_key.json"),
+		filepath.Join(opts.Dir, "reference_state.json"),
+	)
+	reference.Save()
+	return &Node{
+		ChainID:   opts.ChainID,
+		listener:  listener,
+		privKey:   tmCryptoEd2219.GenPrivKey(),
+		timeout:   opts.Timeout,
+		reference: reference,
+		pubKey:    opts.PubKey,
+		signed:    make(map[string][]byte),
+	}, nil
+}
+
+// Address returns the address the signer must dial
+func (node *Node) Address() string {
+	return node.listener.Addr().Network() + "://" + node.listener.Addr().String()
+}
+
+// Accept waits for the signer to connect and completes the SecretConnection handshake
+func (node *Node) Accept() error {
+	if tcpListener, ok := node.listener.(*net.TCPListener); ok {
+		if err := tcpListener.SetDeadline(time.Now().Add(node.timeout)); err != nil {
+			return err
+		}
+	}
+	netConn, err := node.listener.Accept()
+	if err != nil {
+		return fmt.Errorf("waiting for the signer: %w", err)
+	}
+	if err := netConn.SetDeadline(time.Now().Add(node.timeout)); err != nil {
+		netConn.Close()
+		return err
+	}
+	conn, err := tmP2pConn.MakeSecretConnection(netConn, node.privKey)
+	if err != nil {
+		netConn.Close()
+		return fmt.Errorf("secret connection: %w", err)
+	}
+	node.conn = conn
+	return nil
+}
+
+// IsConnected returns whether a signer is connected
+func (node *Node) IsConnected() bool {
+	return node.conn != nil
+}
+
+// request sends the request to the signer and waits for its reply
+func (node *Node) request(req tmProtoPrivval.Message) (tmProtoPrivval.Message, error) {
+	if err := node.conn.SetDeadline(time.Now().Add(node.timeout)); err != nil {
+		return tmProtoPrivval.Message{}, err
+	}
+	if err := internalSigner.WriteMsg(node.conn, req); err != nil {
+		return tmProtoPrivval.Message{}, err
+	}
+	return internalSigner.ReadMsg(node.conn)
+}
+
+// Close closes the connection to the signer and stops listening
+func (node *Node) Close() error {
+	if node.conn != nil {
+		node.conn.Close()
+		node.conn = nil
+	}
+	return node.listener.Close()
+}
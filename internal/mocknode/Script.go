@@ -0,0 +1,322 @@
+package mocknode
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"fmt"
+	"strings"
+	"time"
+
+	tmCryptoEncoding "github.com/tendermint/tendermint/crypto/encoding"
+	tmProtoPrivval "github.com/tendermint/tendermint/proto/tendermint/privval"
+	tmProto "github.com/tendermint/tendermint/proto/tendermint/types"
+	tm "github.com/tendermint/tendermint/types"
+)
+
+// Request is one request of a script: a public key request, a ping, a vote or a proposal
+type Request struct {
+	Name     string
+	PubKey   bool
+	Ping     bool
+	Vote     *tmProto.Vote
+	Proposal *tmProto.Proposal
+}
+
+// Result is the reply of the signer to a request
+type Result struct {
+	Request string
+	// whether the reference FilePV signed the request
+	Expected bool
+	Signed   bool
+	// the error the signer replied with, or the reason no valid reply was received
+	Err error
+}
+
+// Report collects the results of a script and the problems found in them
+type Report struct {
+	Results  []Result
+	Failures []string
+	Duration time.Duration
+}
+
+// OK is true if no problem was found
+func (report *Report) OK() bool {
+	return len(report.Failures) == 0
+}
+
+func (report *Report) failf(format string, args ...interface{}) {
+	report.Failures = append(report.Failures, fmt.Sprintf(format, args...))
+}
+
+// String summarizes the report
+func (report *Report) String() string {
+	var sb strings.Builder
+	signed := 0
+	for _, result := range report.Results {
+		if result.Signed {
+			signed++
+		}
+	}
+	fmt.Fprintf(&sb, "%d requests, %d signed in %v\n", len(report.Results), signed, report.Duration.Round(time.Millisecond))
+	if report.OK() {
+		sb.WriteString("OK\n")
+	}
+	for _, failure := range report.Failures {
+		fmt.Fprintf(&sb, "FAIL: %s\n", failure)
+	}
+	return sb.String()
+}
+
+var (
+	scriptTime  = time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC)
+	scriptBlock = blockID("block")
+)
+
+func blockID(name string) tmProto.BlockID {
+	hash := sha256.Sum256([]byte(name))
+	parts := sha256.Sum256([]byte(name + "/parts"))
+	return tmProto.BlockID{
+		Hash:          hash[:],
+		PartSetHeader: tmProto.PartSetHeader{Total: 1, Hash: parts[:]},
+	}
+}
+
+func vote(voteType tmProto.SignedMsgType, height int64, round int32, block tmProto.BlockID, timestamp time.Time) *tmProto.Vote {
+	return &tmProto.Vote{
+		Type:      voteType,
+		Height:    height,
+		Round:     round,
+		BlockID:   block,
+		Timestamp: timestamp,
+	}
+}
+
+func proposal(height int64, round int32, block tmProto.BlockID, timestamp time.Time) *tmProto.Proposal {
+	return &tmProto.Proposal{
+		Type:      tmProto.ProposalType,
+		Height:    height,
+		Round:     round,
+		PolRound:  -1,
+		BlockID:   block,
+		Timestamp: timestamp,
+	}
+}
+
+// DefaultScript returns a script asking for the public key, then signing the given number
+// of heights with a proposal, a prevote and a precommit each. It goes on with the requests
+// a signer must answer from its sign state: a repeated precommit, a re-timestamped one,
+// a conflicting one and a regression, then a proposal of the last height in round 1
+// together with a re-timestamped copy, and a ping.
+func DefaultScript(heights int) []Request {
+	script := []Request{
+		{Name: "pubkey", PubKey: true},
+		{Name: "ping", Ping: true},
+	}
+	var height int64
+	for height = 1; height <= int64(heights); height++ {
+		stamp := scriptTime.Add(time.Duration(height) * time.Second)
+		script = append(script,
+			Request{Name: fmt.Sprintf("proposal %d/0", height), Proposal: proposal(height, 0, scriptBlock, stamp)},
+			Request{Name: fmt.Sprintf("prevote %d/0", height), Vote: vote(tmProto.PrevoteType, height, 0, scriptBlock, stamp)},
+			Request{Name: fmt.Sprintf("precommit %d/0", height), Vote: vote(tmProto.PrecommitType, height, 0, scriptBlock, stamp)},
+		)
+	}
+	last := height - 1
+	stamp := scriptTime.Add(time.Duration(last) * time.Second)
+	return append(script,
+		Request{Name: "repeated precommit", Vote: vote(tmProto.PrecommitType, last, 0, scriptBlock, stamp)},
+		Request{Name: "re-timestamped precommit", Vote: vote(tmProto.PrecommitType, last, 0, scriptBlock, stamp.Add(time.Second))},
+		Request{Name: "conflicting precommit", Vote: vote(tmProto.PrecommitType, last, 0, blockID("other block"), stamp)},
+		Request{Name: "regressed prevote", Vote: vote(tmProto.PrevoteType, last, 0, scriptBlock, stamp)},
+		Request{Name: "regressed proposal", Proposal: proposal(last-1, 0, scriptBlock, stamp)},
+		Request{Name: fmt.Sprintf("proposal %d/1", last), Proposal: proposal(last, 1, scriptBlock, stamp.Add(2*time.Second))},
+		Request{Name: fmt.Sprintf("re-timestamped proposal %d/1", last), Proposal: proposal(last, 1, scriptBlock, stamp.Add(3*time.Second))},
+		Request{Name: "ping after signing", Ping: true},
+	)
+}
+
+// Run waits for the signer to connect if it is not yet, sends it the requests
+// of the script in order and checks its replies:
+//   - every reply has the type of its request
+//   - the signer signs exactly the requests the reference FilePV signs
+//   - every signature verifies against the public key the signer reported
+//   - a request signed before gets the same signature again
+//   - a request only differing by the timestamp from the last one signed is answered either
+//     with the earlier signature and timestamp, as FilePV does, or with a signature
+//     over the new timestamp
+//   - the signer alters nothing in a vote or proposal but the timestamp and the signature
+func (node *Node) Run(script []Request) *Report {
+	report := &Report{}
+	start := time.Now()
+	defer func() {
+		report.Duration = time.Since(start)
+	}()
+	if !node.IsConnected() {
+		if err := node.Accept(); err != nil {
+			report.failf("%v", err)
+			return report
+		}
+	}
+	for _, req := range script {
+		result := node.runRequest(report, req)
+		report.Results = append(report.Results, result)
+	}
+	return report
+}
+
+func (node *Node) runRequest(report *Report, req Request) Result {
+	result := Result{Request: req.Name}
+	switch {
+	case req.PubKey:
+		node.runPubKey(report, &result)
+	case req.Ping:
+		res, err := node.request(tmProtoPrivval.Message{Sum: &tmProtoPrivval.Message_PingRequest{PingRequest: &tmProtoPrivval.PingRequest{}}})
+		if err != nil {
+			result.Err = err
+			report.failf("%s: %v", req.Name, err)
+		} else if res.GetPingResponse() == nil {
+			report.failf("%s: unexpected reply %T", req.Name, res.Sum)
+		}
+	case req.Vote != nil:
+		node.runVote(report, &result, req.Vote)
+	case req.Proposal != nil:
+		node.runProposal(report, &result, req.Proposal)
+	default:
+		report.failf("%s: request has nothing to send", req.Name)
+	}
+	return result
+}
+
+func (node *Node) runPubKey(report *Report, result *Result) {
+	res, err := node.request(tmProtoPrivval.Message{Sum: &tmProtoPrivval.Message_PubKeyRequest{
+		PubKeyRequest: &tmProtoPrivval.PubKeyRequest{ChainId: node.ChainID},
+	}})
+	if err != nil {
+		result.Err = err
+		report.failf("%s: %v", result.Request, err)
+		return
+	}
+	reply := res.GetPubKeyResponse()
+	switch {
+	case reply == nil:
+		report.failf("%s: unexpected reply %T", result.Request, res.Sum)
+		return
+	case reply.Error != nil:
+		result.Err = fmt.Errorf("%s", reply.Error.Description)
+		report.failf("%s: error %d: %s", result.Request, reply.Error.Code, reply.Error.Description)
+		return
+	}
+	pubKey, err := tmCryptoEncoding.PubKeyFromProto(reply.PubKey)
+	if err != nil {
+		result.Err = err
+		report.failf("%s: %v", result.Request, err)
+		return
+	}
+	if node.pubKey != nil && !node.pubKey.Equals(pubKey) {
+		report.failf("%s: got %v, expected %v", result.Request, pubKey, node.pubKey)
+		return
+	}
+	node.pubKey = pubKey
+}
+
+func (node *Node) runVote(report *Report, result *Result, vote *tmProto.Vote) {
+	reference := *vote
+	referenceErr := node.reference.SignVote(node.ChainID, &reference)
+	result.Expected = referenceErr == nil
+
+	sent := *vote
+	res, err := node.request(tmProtoPrivval.Message{Sum: &tmProtoPrivval.Message_SignVoteRequest{
+		SignVoteRequest: &tmProtoPrivval.SignVoteRequest{Vote: &sent, ChainId: node.ChainID},
+	}})
+	if err != nil {
+		result.Err = err
+		report.failf("%s: %v", result.Request, err)
+		return
+	}
+	reply := res.GetSignedVoteResponse()
+	if reply == nil {
+		report.failf("%s: unexpected reply %T", result.Request, res.Sum)
+		return
+	}
+	if !node.checkOutcome(report, result, reply.Error, referenceErr) {
+		return
+	}
+	signed := reply.Vote
+	signBytes := tm.VoteSignBytes(node.ChainID, &signed)
+	// apart from the timestamp, the vote signed must be the one requested
+	signed.Timestamp = vote.Timestamp
+	if !bytes.Equal(tm.VoteSignBytes(node.ChainID, &signed), tm.VoteSignBytes(node.ChainID, vote)) {
+		report.failf("%s: the vote signed differs from the vote requested", result.Request)
+	}
+	node.checkSignature(report, result.Request, signBytes, reply.Vote.Signature,
+		reply.Vote.Timestamp, vote.Timestamp, reference.Timestamp)
+}
+
+func (node *Node) runProposal(report *Report, result *Result, proposal *tmProto.Proposal) {
+	reference := *proposal
+	referenceErr := node.reference.SignProposal(node.ChainID, &reference)
+	result.Expected = referenceErr == nil
+
+	sent := *proposal
+	res, err := node.request(tmProtoPrivval.Message{Sum: &tmProtoPrivval.Message_SignProposalRequest{
+		SignProposalRequest: &tmProtoPrivval.SignProposalRequest{Proposal: &sent, ChainId: node.ChainID},
+	}})
+	if err != nil {
+		result.Err = err
+		report.failf("%s: %v", result.Request, err)
+		return
+	}
+	reply := res.GetSignedProposalResponse()
+	if reply == nil {
+		report.failf("%s: unexpected reply %T", result.Request, res.Sum)
+		return
+	}
+	if !node.checkOutcome(report, result, reply.Error, referenceErr) {
+		return
+	}
+	signed := reply.Proposal
+	signBytes := tm.ProposalSignBytes(node.ChainID, &signed)
+	signed.Timestamp = proposal.Timestamp
+	if !bytes.Equal(tm.ProposalSignBytes(node.ChainID, &signed), tm.ProposalSignBytes(node.ChainID, proposal)) {
+		report.failf("%s: the proposal signed differs from the proposal requested", result.Request)
+	}
+	node.checkSignature(report, result.Request, signBytes, reply.Proposal.Signature,
+		reply.Proposal.Timestamp, proposal.Timestamp, reference.Timestamp)
+}
+
+// checkOutcome checks that the signer refused the request if and only if the reference did.
+// It returns whether the reply carries a signature to check.
+func (node *Node) checkOutcome(report *Report, result *Result, replyErr *tmProtoPrivval.RemoteSignerError, referenceErr error) bool {
+	if replyErr != nil {
+		result.Err = fmt.Errorf("%s", replyErr.Description)
+	}
+	switch {
+	case replyErr == nil && referenceErr != nil:
+		report.failf("%s: signed, but FilePV refuses it: %v", result.Request, referenceErr)
+		return true
+	case replyErr != nil && referenceErr == nil:
+		report.failf("%s: refused with error %d: %s, but FilePV signs it", result.Request, replyErr.Code, replyErr.Description)
+		return false
+	}
+	result.Signed = replyErr == nil
+	return result.Signed
+}
+
+// checkSignature checks the signature of the sign bytes, signed with the given timestamp
+// for a request with the requested timestamp, which FilePV signed with the reference timestamp
+func (node *Node) checkSignature(report *Report, name string, signBytes []byte, sig []byte, stamp time.Time, requested time.Time, reference time.Time) {
+	if node.pubKey == nil {
+		report.failf("%s: no public key to check the signature against", name)
+		return
+	}
+	if !node.pubKey.VerifySignature(signBytes, sig) {
+		report.failf("%s: signature does not verify against %v", name, node.pubKey)
+	}
+	if !stamp.Equal(requested) && !stamp.Equal(reference) {
+		report.failf("%s: signed with timestamp %v, neither the requested %v nor the earlier %v", name, stamp, requested, reference)
+	}
+	if earlier, ok := node.signed[string(signBytes)]; ok && !bytes.Equal(earlier, sig) {
+		report.failf("%s: signed again with a different signature", name)
+	}
+	node.signed[string(signBytes)] = sig
+}
@@ -0,0 +1,40 @@
+package mocknode
+
+import (
+	"testing"
+)
+
+// Start starts a mock node of the chain for the test on a free loopback port,
+// closed when the test ends
+func Start(tb testing.TB, chainID string) *Node {
+	tb.Helper()
+	return StartWith(tb, Options{ChainID: chainID})
+}
+
+// StartWith starts the mock node of the options for the test, closed when the test ends.
+// The reference FilePV keeps its files in a temporary directory of the test if the options give none.
+func StartWith(tb testing.TB, opts Options) *Node {
+	tb.Helper()
+	if opts.Dir == "" {
+		opts.Dir = tb.TempDir()
+	}
+	node, err := Listen(opts)
+	if err != nil {
+		tb.Fatalf("starting the mock node: %v", err)
+	}
+	tb.Cleanup(func() {
+		node.Close()
+	})
+	return node
+}
+
+// RunScript runs the script against the signer connected to the node, waiting for it
+// to connect first if needed, and fails the test on any problem found
+func RunScript(tb testing.TB, node *Node, script []Request) *Report {
+	tb.Helper()
+	report := node.Run(script)
+	for _, failure := range report.Failures {
+		tb.Error(failure)
+	}
+	return report
+}
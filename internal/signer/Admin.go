@@ -0,0 +1,182 @@
+package signer
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+)
+
+// NodeStatus describes the connection to a Tendermint node
+type NodeStatus struct {
+	Address   string `json:"address"`
+	Connected bool   `json:"connected"`
+}
+
+// ChainStatus is the runtime state of the signer for one chain
+type ChainStatus struct {
+	ChainID   string        `json:"chain_id"`
+	Paused    bool          `json:"paused"`
+	SignState SignState     `json:"sign_state"`
+	Sessions  []SessionInfo `json:"sessions"`
+	Peers     []PeerStatus  `json:"peers"`
+	Nodes     []NodeStatus  `json:"nodes"`
+}
+
+// AdminStatus is the response body of the admin status endpoint
+type AdminStatus struct {
+	Chains []ChainStatus `json:"chains"`
+}
+
+// Admin serves the admin API, meant to be exposed on a local Unix socket only:
+//
+//	GET  /status                        state of every chain, its sessions, peers and nodes
+//	POST /pause[?chain_id=...]          stop taking part in signing rounds
+//	POST /resume[?chain_id=...]         undo /pause
+//	POST /reconnect/node?address=...    drop and redial the connection to a node
+//	POST /reconnect/peer?id=...         replace the socket to a peer cosigner
+//	POST /reload                        reload the configuration file
+type Admin struct {
+	chains []*Chain
+	reload func() error
+}
+
+// NewAdmin returns an Admin for the chains.
+// reload is called to reload the configuration.
+func NewAdmin(chains []*Chain, reload func() error) *Admin {
+	return &Admin{chains: chains, reload: reload}
+}
+
+// Register adds the admin endpoints to the mux
+func (admin *Admin) Register(mux *http.ServeMux) {
+	mux.HandleFunc("/status", admin.serveStatus)
+	mux.HandleFunc("/pause", admin.post(admin.servePause))
+	mux.HandleFunc("/resume", admin.post(admin.serveResume))
+	mux.HandleFunc("/reconnect/node", admin.post(admin.serveReconnectNode))
+	mux.HandleFunc("/reconnect/peer", admin.post(admin.serveReconnectPeer))
+	mux.HandleFunc("/reload", admin.post(admin.serveReload))
+}
+
+// Status returns the runtime state of every chain
+func (admin *Admin) Status() AdminStatus {
+	status := AdminStatus{Chains: make([]ChainStatus, 0, len(admin.chains))}
+	for _, chain := range admin.chains {
+		chainNodes := chain.Nodes()
+		nodes := make([]NodeStatus, 0, len(chainNodes))
+		for _, node := range chainNodes {
+			nodes = append(nodes, NodeStatus{Address: node.Address(), Connected: node.IsConnected()})
+		}
+		status.Chains = append(status.Chains, ChainStatus{
+			ChainID:   chain.ChainID(),
+			Paused:    chain.Local.IsPaused(),
+			SignState: chain.Local.SignState(),
+			Sessions:  chain.Local.Sessions(),
+			Peers:     chain.Peers.Status(),
+			Nodes:     nodes,
+		})
+	}
+	return status
+}
+
+// selectChains returns the chains with the given chain ID, or all chains if it is empty
+func (admin *Admin) selectChains(chainID string) ([]*Chain, error) {
+	if chainID == "" {
+		return admin.chains, nil
+	}
+	for _, chain := range admin.chains {
+		if chain.ChainID() == chainID {
+			return []*Chain{chain}, nil
+		}
+	}
+	return nil, &ChainIDError{ChainID: chainID}
+}
+
+func (admin *Admin) post(handler func(*http.Request) error) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			writeAdminError(w, http.StatusMethodNotAllowed, fmt.Errorf("%s requires POST", r.URL.Path))
+			return
+		}
+		if err := handler(r); err != nil {
+			writeAdminError(w, http.StatusBadRequest, err)
+			return
+		}
+		writeAdminJSON(w, admin.Status())
+	}
+}
+
+func (admin *Admin) serveStatus(w http.ResponseWriter, r *http.Request) {
+	writeAdminJSON(w, admin.Status())
+}
+
+func (admin *Admin) servePause(r *http.Request) error {
+	chains, err := admin.selectChains(r.URL.Query().Get("chain_id"))
+	if err != nil {
+		return err
+	}
+	for _, chain := range chains {
+		chain.Local.Pause()
+	}
+	return nil
+}
+
+func (admin *Admin) serveResume(r *http.Request) error {
+	chains, err := admin.selectChains(r.URL.Query().Get("chain_id"))
+	if err != nil {
+		return err
+	}
+	for _, chain := range chains {
+		chain.Local.Resume()
+	}
+	return nil
+}
+
+func (admin *Admin) serveReconnectNode(r *http.Request) error {
+	address := r.URL.Query().Get("address")
+	found := false
+	for _, chain := range admin.chains {
+		for _, node := range chain.Nodes() {
+			if node.Address() == address {
+				node.Reconnect()
+				found = true
+			}
+		}
+	}
+	if !found {
+		return fmt.Errorf("unknown node %q", address)
+	}
+	return nil
+}
+
+func (admin *Admin) serveReconnectPeer(r *http.Request) error {
+	id, err := strconv.ParseUint(r.URL.Query().Get("id"), 10, 8)
+	if err != nil {
+		return fmt.Errorf("invalid cosigner id: %w", err)
+	}
+	for _, chain := range admin.chains {
+		if err := chain.Peers.Reconnect(byte(id)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (admin *Admin) serveReload(r *http.Request) error {
+	if admin.reload == nil {
+		return fmt.Errorf("reload is not supported")
+	}
+	return admin.reload()
+}
+
+func writeAdminJSON(w http.ResponseWriter, body interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	enc.Encode(body)
+}
+
+func writeAdminError(w http.ResponseWriter, status int, err error) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(map[string]string{"error": err.Error()})
+}
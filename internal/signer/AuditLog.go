@@ -0,0 +1,103 @@
+package signer
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+)
+
+// Decisions recorded in the audit log
+const (
+	AuditAccepted   = "accepted"   // a signing session was started
+	AuditSigned     = "signed"     // a signature (share) was produced or recorded
+	AuditReserved   = "re-served"  // an existing signature was returned
+	AuditRefused    = "refused"    // the request was refused
+	AuditMisbehaved = "misbehaved" // a peer sent an invalid message, failing the signing round
+)
+
+// AuditEvent is one entry of the audit log
+type AuditEvent struct {
+	Time          time.Time `json:"time"`
+	Source        string    `json:"source"`
+	Request       string    `json:"request"`
+	ChainID       string    `json:"chain_id"`
+	Height        int64     `json:"height"`
+	Round         int64     `json:"round"`
+	Step          int8      `json:"step"`
+	SignBytesHash string    `json:"sign_bytes_sha256"`
+	Decision      string    `json:"decision"`
+	Reason        string    `json:"reason,omitempty"`
+}
+
+// AuditLog is an append-only log with one JSON object per line,
+// recording every signing decision of the signer.
+//
+// A nil *AuditLog discards all events.
+type AuditLog struct {
+	mtx  sync.Mutex
+	file *os.File
+}
+
+// OpenAuditLog opens the audit log at path for appending, creating it if needed
+func OpenAuditLog(path string) (*AuditLog, error) {
+	file, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600)
+	if err != nil {
+		return nil, err
+	}
+	return &AuditLog{file: file}, nil
+}
+
+// Record appends a decision about the sign bytes to the log.
+// err is the reason a request was refused, if any.
+// A decision that could not be recorded wraps ErrAuditLog; callers must not act on it.
+func (audit *AuditLog) Record(source string, request string, signBytes []byte, decision string, err error) error {
+	if audit == nil {
+		return nil
+	}
+	hash := sha256.Sum256(signBytes)
+	event := AuditEvent{
+		Time:          time.Now().UTC(),
+		Source:        source,
+		Request:       request,
+		SignBytesHash: hex.EncodeToString(hash[:]),
+		Decision:      decision,
+	}
+	// the sign bytes may be malformed, in which case the HRS is left empty
+	event.Height, event.Round, event.Step, event.ChainID, _ = UnpackHRS(signBytes)
+	if err != nil {
+		event.Reason = err.Error()
+	}
+	if err := audit.write(event); err != nil {
+		return fmt.Errorf("%w: %v", ErrAuditLog, err)
+	}
+	return nil
+}
+
+func (audit *AuditLog) write(event AuditEvent) error {
+	line, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+	line = append(line, '\n')
+
+	audit.mtx.Lock()
+	defer audit.mtx.Unlock()
+	if _, err = audit.file.Write(line); err != nil {
+		return err
+	}
+	return audit.file.Sync()
+}
+
+// Close closes the underlying file
+func (audit *AuditLog) Close() error {
+	if audit == nil {
+		return nil
+	}
+	audit.mtx.Lock()
+	defer audit.mtx.Unlock()
+	return audit.file.Close()
+}
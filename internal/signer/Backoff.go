@@ -0,0 +1,119 @@
+package signer
+
+import (
+	"context"
+	"fmt"
+	"math/rand"
+	"time"
+)
+
+// ReconnectConfig is the backoff between the attempts to reconnect to a node or a peer cosigner:
+// the delay grows by multiplier after each failed attempt up to max_delay_ms, and is randomized
+// by jitter so that cosigners restarted together do not retry in lockstep
+type ReconnectConfig struct {
+	// delay after the first failure (default 500)
+	InitialDelayMs int `toml:"initial_delay_ms"`
+	// cap of the delay (default 30000)
+	MaxDelayMs int `toml:"max_delay_ms"`
+	// factor the delay grows by after each failure (default 2)
+	Multiplier float64 `toml:"multiplier"`
+	// fraction of the delay that is random, between 0 and 1 (default 0.2)
+	Jitter *float64 `toml:"jitter"`
+}
+
+const (
+	defaultReconnectInitial    = 500 * time.Millisecond
+	defaultReconnectMax        = 30 * time.Second
+	defaultReconnectMultiplier = 2
+	defaultReconnectJitter     = 0.2
+)
+
+func (cfg ReconnectConfig) initialDelay() time.Duration {
+	if cfg.InitialDelayMs == 0 {
+		return defaultReconnectInitial
+	}
+	return time.Duration(cfg.InitialDelayMs) * time.Millisecond
+}
+
+func (cfg ReconnectConfig) maxDelay() time.Duration {
+	if cfg.MaxDelayMs == 0 {
+		return defaultReconnectMax
+	}
+	return time.Duration(cfg.MaxDelayMs) * time.Millisecond
+}
+
+// validate returns the problems of the reconnect config
+func (cfg ReconnectConfig) validate() []string {
+	var problems []string
+	if cfg.InitialDelayMs < 0 || cfg.MaxDelayMs < 0 {
+		problems = append(problems, "reconnect: delays must not be negative")
+	}
+	if cfg.initialDelay() > cfg.maxDelay() {
+		problems = append(problems, fmt.Sprintf("reconnect: initial_delay_ms %v is above max_delay_ms %v", cfg.initialDelay(), cfg.maxDelay()))
+	}
+	if cfg.Multiplier != 0 && cfg.Multiplier < 1 {
+		problems = append(problems, fmt.Sprintf("reconnect: multiplier must be at least 1, got %v", cfg.Multiplier))
+	}
+	if cfg.Jitter != nil && (*cfg.Jitter < 0 || *cfg.Jitter > 1) {
+		problems = append(problems, fmt.Sprintf("reconnect: jitter must be between 0 and 1, got %v", *cfg.Jitter))
+	}
+	return problems
+}
+
+// Backoff gives the delays between the attempts to reconnect.
+// It is not safe for concurrent use.
+type Backoff struct {
+	initial    time.Duration
+	max        time.Duration
+	multiplier float64
+	jitter     float64
+
+	// delay before the next attempt, before jitter
+	next time.Duration
+}
+
+// NewBackoff returns the backoff of the config
+func NewBackoff(cfg ReconnectConfig) *Backoff {
+	backoff := &Backoff{
+		initial:    cfg.initialDelay(),
+		max:        cfg.maxDelay(),
+		multiplier: cfg.Multiplier,
+		jitter:     defaultReconnectJitter,
+	}
+	if backoff.multiplier == 0 {
+		backoff.multiplier = defaultReconnectMultiplier
+	}
+	if cfg.Jitter != nil {
+		backoff.jitter = *cfg.Jitter
+	}
+	backoff.Reset()
+	return backoff
+}
+
+// Next returns the delay before the next attempt after a failed one
+func (backoff *Backoff) Next() time.Duration {
+	delay := backoff.next
+	backoff.next = time.Duration(float64(backoff.next) * backoff.multiplier)
+	if backoff.next > backoff.max {
+		backoff.next = backoff.max
+	}
+	// the jitter only ever shortens the delay, so that it stays within the cap
+	return delay - time.Duration(backoff.jitter*rand.Float64()*float64(delay))
+}
+
+// Reset starts over from the initial delay, after a successful attempt
+func (backoff *Backoff) Reset() {
+	backoff.next = backoff.initial
+}
+
+// sleep waits for the delay, returning false early if the context is done first
+func sleep(ctx context.Context, delay time.Duration) bool {
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
@@ -0,0 +1,69 @@
+package signer
+
+import (
+	"testing"
+	"time"
+)
+
+func TestBackoffNext(t *testing.T) {
+	noJitter := 0.0
+	halfJitter := 0.5
+	cases := []struct {
+		name string
+		cfg  ReconnectConfig
+		// delays before jitter
+		want []time.Duration
+		// fraction of each delay the jitter may take off
+		jitter float64
+	}{
+		{
+			name:   "defaults",
+			cfg:    ReconnectConfig{Jitter: &noJitter},
+			want:   []time.Duration{500 * time.Millisecond, time.Second, 2 * time.Second, 4 * time.Second, 8 * time.Second, 16 * time.Second, 30 * time.Second, 30 * time.Second},
+			jitter: 0,
+		},
+		{
+			name:   "capped",
+			cfg:    ReconnectConfig{InitialDelayMs: 100, MaxDelayMs: 250, Multiplier: 3, Jitter: &noJitter},
+			want:   []time.Duration{100 * time.Millisecond, 250 * time.Millisecond, 250 * time.Millisecond},
+			jitter: 0,
+		},
+		{
+			name:   "constant",
+			cfg:    ReconnectConfig{InitialDelayMs: 100, Multiplier: 1, Jitter: &noJitter},
+			want:   []time.Duration{100 * time.Millisecond, 100 * time.Millisecond, 100 * time.Millisecond},
+			jitter: 0,
+		},
+		{
+			name:   "default jitter",
+			cfg:    ReconnectConfig{InitialDelayMs: 1000, MaxDelayMs: 4000},
+			want:   []time.Duration{time.Second, 2 * time.Second, 4 * time.Second, 4 * time.Second},
+			jitter: defaultReconnectJitter,
+		},
+		{
+			name:   "jitter",
+			cfg:    ReconnectConfig{InitialDelayMs: 1000, MaxDelayMs: 4000, Jitter: &halfJitter},
+			want:   []time.Duration{time.Second, 2 * time.Second, 4 * time.Second, 4 * time.Second},
+			jitter: halfJitter,
+		},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			// jitter is random, so each sequence is drawn a few times
+			for run := 0; run < 20; run++ {
+				backoff := NewBackoff(c.cfg)
+				for i, want := range c.want {
+					delay := backoff.Next()
+					min := want - time.Duration(c.jitter*float64(want))
+					if delay < min || delay > want {
+						t.Fatalf("delay %d is %v, want between %v and %v", i, delay, min, want)
+					}
+				}
+				backoff.Reset()
+				if delay := backoff.Next(); delay > c.want[0] {
+					t.Fatalf("delay after a reset is %v, want at most %v", delay, c.want[0])
+				}
+			}
+		})
+	}
+}
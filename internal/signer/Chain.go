@@ -0,0 +1,169 @@
+package signer
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"sync"
+
+	tmLog "github.com/tendermint/tendermint/libs/log"
+	tm "github.com/tendermint/tendermint/types"
+)
+
+// Chain holds the components signing for one chain:
+// the threshold validator and the connections to the chain's nodes.
+// Nodes can be added and removed while it is running.
+type Chain struct {
+	Local         *LocalCosigner
+	Peers         *RemoteCosigners
+	PrivValidator tm.PrivValidator
+
+	// faults injected into the connections in chaos mode, nil otherwise
+	Faults *FaultInjector
+
+	validator  *ThresholdValidator
+	logger     tmLog.Logger
+	audit      *AuditLog
+	connection NodeConnectionConfig
+	reconnect  ReconnectConfig
+
+	nodesMtx sync.Mutex
+	nodes    []*ReconnRemoteSigner
+}
+
+// NewChain creates the threshold validator of the local cosigner's chain
+func NewChain(logger tmLog.Logger, cfg CoConfig, local *LocalCosigner, audit *AuditLog) (*Chain, error) {
+	// each chain has its own connections to the peers, so that
+	// signing on one chain does not wait for the others
+	peers, err := NewRemoteCosigners(cfg)
+	if err != nil {
+		return nil, err
+	}
+	logger = logger.With("chain_id", local.ChainID())
+	faults := NewFaultInjector(cfg.Chaos)
+	peers.SetFaultInjector(faults)
+	peers.SetAuditLog(audit)
+	peers.SetLogger(logger.With("module", "peers"))
+	if err := peers.Start(); err != nil {
+		return nil, err
+	}
+	// the nodes call the validator concurrently: identical requests are coalesced
+	// and the sessions of different HRS run in parallel
+	val := NewThresholdValidator(local, peers)
+	return &Chain{
+		Local:         local,
+		Peers:         peers,
+		PrivValidator: val,
+		Faults:        faults,
+		validator:     val,
+		logger:        logger,
+		audit:         audit,
+		connection:    cfg.NodeConnection,
+		reconnect:     cfg.Reconnect,
+	}, nil
+}
+
+// ChainID returns the chain ID of the chain
+func (chain *Chain) ChainID() string {
+	return chain.Local.ChainID()
+}
+
+// Nodes returns the connections to the nodes of the chain
+func (chain *Chain) Nodes() []*ReconnRemoteSigner {
+	chain.nodesMtx.Lock()
+	defer chain.nodesMtx.Unlock()
+	return append([]*ReconnRemoteSigner(nil), chain.nodes...)
+}
+
+// AddNode starts signing for the node at the address
+func (chain *Chain) AddNode(address string) error {
+	chain.nodesMtx.Lock()
+	defer chain.nodesMtx.Unlock()
+	for _, node := range chain.nodes {
+		if node.Address() == address {
+			return fmt.Errorf("node %q already added", address)
+		}
+	}
+	dialer := net.Dialer{
+		Timeout:   chain.connection.dialTimeout(),
+		KeepAlive: chain.connection.keepAlive(),
+	}
+	node := NewReconnRemoteSigner(address, chain.logger, chain.ChainID(), chain.PrivValidator, dialer)
+	node.SetTimeouts(chain.connection.writeTimeout(), chain.connection.idleTimeout())
+	node.SetReconnect(chain.reconnect)
+	node.SetAuditLog(chain.audit)
+	node.SetFaultInjector(chain.Faults)
+	if err := node.Start(); err != nil {
+		return err
+	}
+	chain.nodes = append(chain.nodes, node)
+	return nil
+}
+
+// RemoveNode stops signing for the node at the address
+func (chain *Chain) RemoveNode(address string) error {
+	chain.nodesMtx.Lock()
+	defer chain.nodesMtx.Unlock()
+	for i, node := range chain.nodes {
+		if node.Address() == address {
+			chain.nodes = append(chain.nodes[:i], chain.nodes[i+1:]...)
+			return node.Stop()
+		}
+	}
+	return fmt.Errorf("unknown node %q", address)
+}
+
+// SetNodes adds and removes nodes so that the chain signs for exactly the given nodes
+func (chain *Chain) SetNodes(nodes []NodeConfig) error {
+	wanted := make(map[string]bool, len(nodes))
+	for _, node := range nodes {
+		wanted[node.Address] = true
+	}
+	current := make(map[string]bool)
+	for _, node := range chain.Nodes() {
+		current[node.Address()] = true
+		if !wanted[node.Address()] {
+			chain.logger.Info("Removing node", "address", node.Address())
+			if err := chain.RemoveNode(node.Address()); err != nil {
+				return err
+			}
+		}
+	}
+	for _, node := range nodes {
+		if !current[node.Address] {
+			chain.logger.Info("Adding node", "address", node.Address)
+			if err := chain.AddNode(node.Address); err != nil {
+				return err
+			}
+			current[node.Address] = true
+		}
+	}
+	return nil
+}
+
+// StopNodes stops signing for all the nodes
+func (chain *Chain) StopNodes() error {
+	chain.nodesMtx.Lock()
+	defer chain.nodesMtx.Unlock()
+	for _, node := range chain.nodes {
+		if err := node.Stop(); err != nil {
+			return err
+		}
+	}
+	chain.nodes = nil
+	return nil
+}
+
+// Stop shuts the chain down: new signing rounds are refused, the rounds in progress are
+// waited for until the context is done, then the nodes and the peers are disconnected.
+// Rounds still in progress after that are aborted.
+func (chain *Chain) Stop(ctx context.Context) error {
+	if err := chain.validator.Drain(ctx); err != nil {
+		chain.logger.Error("Aborting signing rounds in progress", "err", err)
+	}
+	err := chain.StopNodes()
+	if stopErr := chain.Peers.Stop(); stopErr != nil && err == nil {
+		err = stopErr
+	}
+	return err
+}
@@ -4,8 +4,10 @@ package signer
 
 import (
 	"encoding/json"
+	"fmt"
 	"io/ioutil"
 	"os"
+	"strings"
 
 	"github.com/taurusgroup/frost-ed25519/pkg/eddsa"
 
@@ -21,6 +23,7 @@ type CosignerConfig struct {
 	Address string `toml:"remote_address"`
 }
 
+// LoadConfigFromFile reads the config file and applies the overrides from the environment (see ApplyEnv)
 func LoadConfigFromFile(file string) (CoConfig, error) {
 	var config CoConfig
 
@@ -28,7 +31,12 @@ func LoadConfigFromFile(file string) (CoConfig, error) {
 	if err != nil {
 		return config, err
 	}
+	defer reader.Close()
 	_, err = toml.DecodeReader(reader, &config)
+	if err != nil {
+		return config, err
+	}
+	err = config.ApplyEnv(os.Environ())
 	return config, err
 }
 
@@ -41,10 +49,171 @@ type CoConfig struct {
 	KeygenProxyPub    string `toml:"keygen_proxy_pub"`
 	KeygenProxySub    string `toml:"keygen_proxy_sub"`
 	SessionTimeoutSec int    `toml:"session_timeout_sec"`
+	// address to serve /metrics, /healthz and /readyz on over HTTP (disabled if empty)
+	HttpListenAddress string `toml:"http_listen_address"`
+	// file to append the JSON audit log of signing decisions to (disabled if empty)
+	AuditLogFile string `toml:"audit_log_file"`
+	// path of the Unix socket serving the admin API (disabled if empty)
+	AdminSocket string `toml:"admin_socket"`
+	// export of the traces of signing rounds
+	Tracing TracingConfig `toml:"tracing"`
+	// fault injection for staging clusters
+	Chaos ChaosConfig `toml:"chaos"`
+	// timeouts and keepalive of the connections to the nodes
+	NodeConnection NodeConnectionConfig `toml:"node_connection"`
+	// backoff between the attempts to reconnect to a node or a peer
+	Reconnect ReconnectConfig `toml:"reconnect"`
 
 	ListenAddress string           `toml:"cosigner_listen_address"`
 	Nodes         []NodeConfig     `toml:"node"`
 	Cosigners     []CosignerConfig `toml:"cosigner"`
+	Chains        []ChainConfig    `toml:"chain"`
+}
+
+// ChainConfig holds the settings of one chain served by the cosigner cluster.
+// Requests between cosigners are routed to the chain by the chain ID in their sign bytes,
+// so all chains share the cosigner listen address, IDs and threshold.
+type ChainConfig struct {
+	ChainID          string       `toml:"chain_id"`
+	KeySharePath     string       `toml:"key_share_file"`
+	PrivValStateFile string       `toml:"state_file"`
+	Nodes            []NodeConfig `toml:"node"`
+}
+
+// ChainConfigs returns all the chains in the config: the chain described by the
+// top-level chain_id, key_share_file, state_file and node entries (if chain_id is set),
+// followed by any [[chain]] blocks.
+func (cfg CoConfig) ChainConfigs() []ChainConfig {
+	chains := make([]ChainConfig, 0, len(cfg.Chains)+1)
+	if cfg.ChainID != "" {
+		chains = append(chains, ChainConfig{
+			ChainID:          cfg.ChainID,
+			KeySharePath:     cfg.KeySharePath,
+			PrivValStateFile: cfg.PrivValStateFile,
+			Nodes:            cfg.Nodes,
+		})
+	}
+	return append(chains, cfg.Chains...)
+}
+
+// FindChain returns the chain config with the given chain ID.
+// An empty chain ID selects the only configured chain.
+func (cfg CoConfig) FindChain(chainID string) (ChainConfig, error) {
+	chains := cfg.ChainConfigs()
+	if chainID == "" {
+		if len(chains) != 1 {
+			return ChainConfig{}, fmt.Errorf("expected exactly one chain, found %d", len(chains))
+		}
+		return chains[0], nil
+	}
+	for _, chain := range chains {
+		if chain.ChainID == chainID {
+			return chain, nil
+		}
+	}
+	return ChainConfig{}, fmt.Errorf("chain %q not found", chainID)
+}
+
+// ConfigError lists the problems found by CoConfig.Validate
+type ConfigError struct {
+	Problems []string
+}
+
+func (e *ConfigError) Error() string {
+	return "invalid config:\n  " + strings.Join(e.Problems, "\n  ")
+}
+
+// Validate checks that the config describes a usable cosigner:
+// the cosigner IDs must be 1 to the number of cosigners, each appearing once,
+// the threshold must be at least 1 and allow a quorum of the peers,
+// and every chain needs a chain ID, a key share and a state file of its own.
+func (cfg CoConfig) Validate() error {
+	var problems []string
+	problemf := func(format string, args ...interface{}) {
+		problems = append(problems, fmt.Sprintf(format, args...))
+	}
+
+	total := len(cfg.Cosigners) + 1
+	if cfg.CosignerId == 0 || int(cfg.CosignerId) > total {
+		problemf("cosigner_id: %d is not between 1 and the number of cosigners (%d)", cfg.CosignerId, total)
+	}
+	if cfg.CosignerThreshold == 0 {
+		problemf("cosigner_threshold: must be at least 1")
+	} else if int(cfg.CosignerThreshold) > len(cfg.Cosigners) {
+		// a signing round needs the local cosigner and threshold peers
+		problemf("cosigner_threshold: %d needs %d peers to sign, but only %d [[cosigner]] entries are configured",
+			cfg.CosignerThreshold, cfg.CosignerThreshold, len(cfg.Cosigners))
+	}
+	if cfg.SessionTimeoutSec <= 0 {
+		problemf("session_timeout_sec: must be positive, got %d", cfg.SessionTimeoutSec)
+	}
+	if cfg.ListenAddress == "" {
+		problemf("cosigner_listen_address: must be set")
+	}
+
+	ids := map[int]bool{int(cfg.CosignerId): true}
+	for i, cosigner := range cfg.Cosigners {
+		if cosigner.ID == int(cfg.CosignerId) {
+			problemf("cosigner[%d]: id %d is our own cosigner_id", i, cosigner.ID)
+		} else if ids[cosigner.ID] {
+			problemf("cosigner[%d]: duplicate id %d", i, cosigner.ID)
+		}
+		ids[cosigner.ID] = true
+		if cosigner.ID < 1 || cosigner.ID > total {
+			problemf("cosigner[%d]: id %d is not between 1 and the number of cosigners (%d)", i, cosigner.ID, total)
+		}
+		if cosigner.Address == "" {
+			problemf("cosigner[%d]: remote_address must be set", i)
+		}
+	}
+
+	chains := cfg.ChainConfigs()
+	if len(chains) == 0 {
+		problemf("chain_id: must be set, or at least one [[chain]] block configured")
+	}
+	if cfg.ChainID == "" && (cfg.KeySharePath != "" || cfg.PrivValStateFile != "" || len(cfg.Nodes) > 0) {
+		problemf("chain_id: must be set when key_share_file, state_file or [[node]] are set at the top level")
+	}
+	chainIDs := make(map[string]bool)
+	stateFiles := make(map[string]string)
+	for _, chain := range chains {
+		name := fmt.Sprintf("chain %q", chain.ChainID)
+		if chain.ChainID == "" {
+			name = "chain"
+			problemf("%s: chain_id must be set", name)
+		} else if chainIDs[chain.ChainID] {
+			problemf("%s: duplicate chain_id", name)
+		} else if strings.HasPrefix(chain.ChainID, TestSignChainPrefix) {
+			problemf("%s: chain_id must not start with %q, which is reserved for test-sign", name, TestSignChainPrefix)
+		}
+		chainIDs[chain.ChainID] = true
+		if chain.KeySharePath == "" {
+			problemf("%s: key_share_file must be set", name)
+		}
+		if chain.PrivValStateFile == "" {
+			problemf("%s: state_file must be set", name)
+		} else if other, ok := stateFiles[chain.PrivValStateFile]; ok {
+			problemf("%s: state_file %q is also used by chain %q", name, chain.PrivValStateFile, other)
+		} else {
+			stateFiles[chain.PrivValStateFile] = chain.ChainID
+		}
+		for i, node := range chain.Nodes {
+			if node.Address == "" {
+				problemf("%s: node[%d]: address must be set", name, i)
+			}
+		}
+	}
+
+	problems = append(problems, cfg.NodeConnection.validate()...)
+	problems = append(problems, cfg.Reconnect.validate()...)
+	if cfg.Chaos.Enabled {
+		problems = append(problems, cfg.Chaos.validate()...)
+	}
+
+	if len(problems) > 0 {
+		return &ConfigError{Problems: problems}
+	}
+	return nil
 }
 
 type KeyGenOutput struct {
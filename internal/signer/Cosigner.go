@@ -1,5 +1,17 @@
 package signer
 
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"strconv"
+)
+
+// CosignerProtocolVersion is the version of the protocol between cosigners.
+// It is reported in the replies to pings.
+const CosignerProtocolVersion = 1
+
 type CosignerStartSessionRequest struct {
 	ID        byte
 	SignBytes []byte
@@ -9,6 +21,9 @@ type CosignerStartSessionRequest struct {
 type CosignerStartSessionResponse struct {
 	Msg1Out  [][]byte
 	MaybeSig []byte
+	// signatures the peers replied with instead of their messages, by peer ID.
+	// They are not verified.
+	PeerSigs map[byte][]byte
 }
 
 type CosignerEndSessionRequest struct {
@@ -21,6 +36,9 @@ type CosignerEndSessionRequest struct {
 type CosignerEndSessionResponse struct {
 	Msg2Out  [][]byte
 	MaybeSig []byte
+	// signatures the peers replied with instead of their messages, by peer ID.
+	// They are not verified.
+	PeerSigs map[byte][]byte
 }
 
 type CosignerSetSignatureRequest struct {
@@ -33,59 +51,199 @@ type CosignerSetSignatureResponse struct {
 	ID byte
 }
 
+// CosignerPingRequest checks that a cosigner is reachable
+type CosignerPingRequest struct {
+	ID byte
+}
+
+// ChainHRS is the last height, round and step a cosigner signed for a chain
+type ChainHRS struct {
+	ChainID string `json:"chain_id"`
+	Height  int64  `json:"height"`
+	Round   int64  `json:"round"`
+	Step    int8   `json:"step"`
+}
+
+// CosignerPongResponse is the reply to a ping: ["pong", version, JSON of the chains' last HRS].
+// Cosigners before protocol version 1 reply with a bare ["pong"].
+type CosignerPongResponse struct {
+	Version int
+	Chains  []ChainHRS
+}
+
+// ToMsg encodes the pong in its message frames
+func (res CosignerPongResponse) ToMsg() [][]byte {
+	chains, err := json.Marshal(res.Chains)
+	if err != nil {
+		panic(err)
+	}
+	return [][]byte{[]byte("pong"), []byte(strconv.Itoa(res.Version)), chains}
+}
+
+// MsgToPong decodes a reply to a ping
+func MsgToPong(msg [][]byte) (CosignerPongResponse, error) {
+	res := CosignerPongResponse{}
+	if len(msg) == 0 || !bytes.Equal(msg[0], []byte("pong")) {
+		return res, ErrUnexpectedReply
+	}
+	if len(msg) < 3 {
+		return res, nil
+	}
+	version, err := strconv.Atoi(string(msg[1]))
+	if err != nil {
+		return res, ErrUnexpectedReply
+	}
+	res.Version = version
+	if err := json.Unmarshal(msg[2], &res.Chains); err != nil {
+		return res, ErrUnexpectedReply
+	}
+	return res, nil
+}
+
+// CosignerCommitmentsRequest asks a cosigner for nonce commitments for preprocessed signing.
+// It is sent as [header, chain ID, count] and answered with ["commitments", commitment...].
+type CosignerCommitmentsRequest struct {
+	ID      byte
+	ChainID string
+	Count   int
+}
+
+// CosignerSignRequest asks a cosigner for its signature share over the commitments of the parties.
+// It is sent as [header, sign bytes, commitment...] and answered with ["share", z].
+type CosignerSignRequest struct {
+	ID          byte
+	SignBytes   []byte
+	Commitments [][]byte
+}
+
+type CosignerSignResponse struct {
+	Share    []byte
+	MaybeSig []byte
+}
+
 type CosignerRequest interface {
 	PartyId() byte
+	GetSignBytes() []byte
 }
 
 func (req CosignerStartSessionRequest) PartyId() byte {
 	return req.ID
 }
 
+func (req CosignerStartSessionRequest) GetSignBytes() []byte {
+	return req.SignBytes
+}
+
 func (req CosignerEndSessionRequest) PartyId() byte {
 	return req.ID
 }
 
+func (req CosignerEndSessionRequest) GetSignBytes() []byte {
+	return req.SignBytes
+}
+
 func (req CosignerSetSignatureRequest) PartyId() byte {
 	return req.ID
 }
 
-func MsgToRequest(msg [][]byte) CosignerRequest {
-	if len(msg) < 3 {
-		return nil
-	}
-	if len(msg[0]) < 2 {
-		return nil
+func (req CosignerSetSignatureRequest) GetSignBytes() []byte {
+	return req.SignBytes
+}
+
+func (req CosignerPingRequest) PartyId() byte {
+	return req.ID
+}
+
+func (req CosignerPingRequest) GetSignBytes() []byte {
+	return nil
+}
+
+func (req CosignerCommitmentsRequest) PartyId() byte {
+	return req.ID
+}
+
+func (req CosignerCommitmentsRequest) GetSignBytes() []byte {
+	return nil
+}
+
+func (req CosignerSignRequest) PartyId() byte {
+	return req.ID
+}
+
+func (req CosignerSignRequest) GetSignBytes() []byte {
+	return req.SignBytes
+}
+
+// most frames of a request: a header, sign bytes, a party set and a message of each party
+const maxRequestFrames = 3 + 256
+
+// MsgToRequest decodes the frames of a request from a peer.
+// Malformed requests are refused with an error wrapping ErrInvalidRequest.
+func MsgToRequest(msg [][]byte) (CosignerRequest, error) {
+	if len(msg) == 0 || len(msg[0]) < 2 {
+		return nil, fmt.Errorf("%w: no header", ErrInvalidRequest)
 	}
-	if len(msg[1]) == 0 || len(msg[2]) == 0 {
-		return nil
+	if len(msg) > maxRequestFrames {
+		return nil, fmt.Errorf("%w: %d frames", ErrInvalidRequest, len(msg))
 	}
 	roundt := msg[0][0]
 	partyId := msg[0][1]
+	if roundt == 3 {
+		return CosignerPingRequest{ID: partyId}, nil
+	}
+	if len(msg) < 3 || len(msg[1]) == 0 || len(msg[2]) == 0 {
+		return nil, fmt.Errorf("%w: request type %d with missing frames", ErrInvalidRequest, roundt)
+	}
 	switch roundt {
 	case 0:
+		if len(msg) != 3 {
+			return nil, fmt.Errorf("%w: start session with %d frames", ErrInvalidRequest, len(msg))
+		}
 		req := CosignerStartSessionRequest{}
 		req.SignBytes = msg[1]
 		req.PartyIDs = msg[2]
 		req.ID = partyId
-		return req
+		return req, nil
 	case 1:
 		if len(msg) < 3+len(msg[2]) {
-			return nil
+			return nil, fmt.Errorf("%w: end session with %d messages for %d parties", ErrInvalidRequest, len(msg)-3, len(msg[2]))
 		}
 		req := CosignerEndSessionRequest{}
 		req.SignBytes = msg[1]
 		req.PartyIDs = msg[2]
 		req.Msg1Out = msg[3:]
 		req.ID = partyId
-		return req
+		return req, nil
 	case 2:
+		if len(msg) != 3 {
+			return nil, fmt.Errorf("%w: set signature with %d frames", ErrInvalidRequest, len(msg))
+		}
 		req := CosignerSetSignatureRequest{}
 		req.SignBytes = msg[1]
 		req.Sig = msg[2]
 		req.ID = partyId
-		return req
+		return req, nil
+	case 4:
+		if len(msg) != 3 {
+			return nil, fmt.Errorf("%w: commitments request with %d frames", ErrInvalidRequest, len(msg))
+		}
+		count, err := strconv.Atoi(string(msg[2]))
+		if err != nil {
+			return nil, fmt.Errorf("%w: commitment count %q", ErrInvalidRequest, msg[2])
+		}
+		req := CosignerCommitmentsRequest{}
+		req.ChainID = string(msg[1])
+		req.Count = count
+		req.ID = partyId
+		return req, nil
+	case 5:
+		req := CosignerSignRequest{}
+		req.SignBytes = msg[1]
+		req.Commitments = msg[2:]
+		req.ID = partyId
+		return req, nil
 	default:
-		return nil
+		return nil, fmt.Errorf("%w: unknown request type %d", ErrInvalidRequest, roundt)
 	}
 }
 
@@ -93,11 +251,11 @@ func MsgToRequest(msg [][]byte) CosignerRequest {
 // This interface abstracts the underlying key storage and management
 type Cosigner interface {
 	// Start signing session
-	StartSession(req CosignerStartSessionRequest) (CosignerStartSessionResponse, error)
+	StartSession(ctx context.Context, req CosignerStartSessionRequest) (CosignerStartSessionResponse, error)
 
 	// Final round
-	EndSession(req CosignerEndSessionRequest) (CosignerEndSessionResponse, error)
+	EndSession(ctx context.Context, req CosignerEndSessionRequest) (CosignerEndSessionResponse, error)
 
 	// Set the provided signature
-	SetSignature(req CosignerSetSignatureRequest) (CosignerSetSignatureResponse, error)
+	SetSignature(ctx context.Context, req CosignerSetSignatureRequest) (CosignerSetSignatureResponse, error)
 }
@@ -0,0 +1,180 @@
+package signer
+
+import (
+	"fmt"
+	"io/ioutil"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// EnvPrefix is the prefix of the environment variables overriding the config
+const EnvPrefix = "TMKMS"
+
+// ApplyEnv overrides the config with environment variables.
+//
+// Each field is named after its TOML key in upper case, prefixed with TMKMS_,
+// e.g. TMKMS_CHAIN_ID or TMKMS_TRACING_OTLP_ENDPOINT. Entries of [[node]],
+// [[cosigner]] and [[chain]] are set by index, e.g. TMKMS_NODE_0_ADDRESS,
+// TMKMS_COSIGNER_1_REMOTE_ADDRESS or TMKMS_CHAIN_0_NODE_0_ADDRESS; indices past the
+// end of the list add entries. Appending _FILE to a variable reads the value from
+// the named file instead, so that secrets can be mounted rather than put in the environment.
+//
+// A TMKMS_ variable that does not override any field, because it is misspelled or its
+// index leaves a gap in a list, is an error.
+func (cfg *CoConfig) ApplyEnv(environ []string) error {
+	env := &envVars{values: make(map[string]string, len(environ)), used: make(map[string]bool)}
+	for _, kv := range environ {
+		parts := strings.SplitN(kv, "=", 2)
+		if len(parts) == 2 && strings.HasPrefix(parts[0], EnvPrefix+"_") {
+			env.values[parts[0]] = parts[1]
+		}
+	}
+	if err := applyEnv(reflect.ValueOf(cfg).Elem(), EnvPrefix, env); err != nil {
+		return err
+	}
+	var unused []string
+	for key := range env.values {
+		if !env.used[key] {
+			unused = append(unused, key)
+		}
+	}
+	if len(unused) > 0 {
+		sort.Strings(unused)
+		return fmt.Errorf("environment variables do not override any setting: %s", strings.Join(unused, ", "))
+	}
+	return nil
+}
+
+// envVars are the TMKMS_ environment variables, and which of them were used
+type envVars struct {
+	values map[string]string
+	used   map[string]bool
+}
+
+func applyEnv(v reflect.Value, prefix string, env *envVars) error {
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		tag := t.Field(i).Tag.Get("toml")
+		if t.Field(i).Anonymous && tag == "" && v.Field(i).Kind() == reflect.Struct {
+			// the fields of embedded structs are at the level of the struct, as in TOML
+			if err := applyEnv(v.Field(i), prefix, env); err != nil {
+				return err
+			}
+			continue
+		}
+		if tag == "" || tag == "-" {
+			continue
+		}
+		name := prefix + "_" + strings.ToUpper(tag)
+		field := v.Field(i)
+		switch {
+		case field.Kind() == reflect.Struct:
+			if err := applyEnv(field, name, env); err != nil {
+				return err
+			}
+		case field.Kind() == reflect.Slice && field.Type().Elem().Kind() == reflect.Struct:
+			if err := applyEnvList(field, name, env); err != nil {
+				return err
+			}
+		default:
+			value, ok, err := lookupEnv(name, env)
+			if err != nil {
+				return err
+			}
+			if !ok {
+				continue
+			}
+			if err := setEnvValue(field, value); err != nil {
+				return fmt.Errorf("%s: %w", name, err)
+			}
+		}
+	}
+	return nil
+}
+
+// applyEnvList sets the entries of a list of tables, growing it while variables for the next index exist
+func applyEnvList(list reflect.Value, name string, env *envVars) error {
+	for i := 0; ; i++ {
+		prefix := name + "_" + strconv.Itoa(i)
+		if i >= list.Len() {
+			if !hasEnvPrefix(prefix+"_", env) {
+				return nil
+			}
+			list.Set(reflect.Append(list, reflect.Zero(list.Type().Elem())))
+		}
+		if err := applyEnv(list.Index(i), prefix, env); err != nil {
+			return err
+		}
+	}
+}
+
+func hasEnvPrefix(prefix string, env *envVars) bool {
+	for key := range env.values {
+		if strings.HasPrefix(key, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// lookupEnv returns the value of the variable, or the contents of the file named by its _FILE variant
+func lookupEnv(name string, env *envVars) (string, bool, error) {
+	if value, ok := env.values[name]; ok {
+		env.used[name] = true
+		return value, true, nil
+	}
+	path, ok := env.values[name+"_FILE"]
+	if !ok {
+		return "", false, nil
+	}
+	env.used[name+"_FILE"] = true
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return "", false, fmt.Errorf("%s_FILE: %w", name, err)
+	}
+	return strings.TrimRight(string(data), "\r\n"), true, nil
+}
+
+func setEnvValue(field reflect.Value, value string) error {
+	if field.Kind() == reflect.Ptr {
+		elem := reflect.New(field.Type().Elem())
+		if err := setEnvValue(elem.Elem(), value); err != nil {
+			return err
+		}
+		field.Set(elem)
+		return nil
+	}
+	switch field.Kind() {
+	case reflect.String:
+		field.SetString(value)
+	case reflect.Bool:
+		b, err := strconv.ParseBool(value)
+		if err != nil {
+			return err
+		}
+		field.SetBool(b)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		n, err := strconv.ParseInt(value, 10, field.Type().Bits())
+		if err != nil {
+			return err
+		}
+		field.SetInt(n)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		n, err := strconv.ParseUint(value, 10, field.Type().Bits())
+		if err != nil {
+			return err
+		}
+		field.SetUint(n)
+	case reflect.Float32, reflect.Float64:
+		f, err := strconv.ParseFloat(value, field.Type().Bits())
+		if err != nil {
+			return err
+		}
+		field.SetFloat(f)
+	default:
+		return fmt.Errorf("unsupported type %s", field.Type())
+	}
+	return nil
+}
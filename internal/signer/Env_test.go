@@ -0,0 +1,140 @@
+package signer
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestApplyEnv(t *testing.T) {
+	dir := t.TempDir()
+	secret := filepath.Join(dir, "secret")
+	if err := ioutil.WriteFile(secret, []byte("tcp://10.0.0.2:1234\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	base := func() CoConfig {
+		return CoConfig{
+			ChainID:           "chain-1",
+			SessionTimeoutSec: 5,
+			Nodes:             []NodeConfig{{Address: "tcp://10.0.0.1:1234"}},
+			Cosigners:         []CosignerConfig{{ID: 2, Address: "tcp://10.0.1.2:2222"}},
+		}
+	}
+
+	cases := []struct {
+		name    string
+		environ []string
+		// changes the environment makes to the base config
+		want func(*CoConfig)
+		// substring of the error, if the environment is refused
+		err string
+	}{
+		{
+			name:    "no variables",
+			environ: []string{"HOME=/root"},
+			want:    func(*CoConfig) {},
+		},
+		{
+			name:    "scalars",
+			environ: []string{"TMKMS_CHAIN_ID=chain-2", "TMKMS_SESSION_TIMEOUT_SEC=7", "TMKMS_COSIGNER_ID=3"},
+			want: func(cfg *CoConfig) {
+				cfg.ChainID = "chain-2"
+				cfg.SessionTimeoutSec = 7
+				cfg.CosignerId = 3
+			},
+		},
+		{
+			name:    "nested",
+			environ: []string{"TMKMS_TRACING_OTLP_ENDPOINT=collector:4317", "TMKMS_TRACING_OTLP_INSECURE=true"},
+			want: func(cfg *CoConfig) {
+				cfg.Tracing.OtlpEndpoint = "collector:4317"
+				cfg.Tracing.OtlpInsecure = true
+			},
+		},
+		{
+			name:    "pointer",
+			environ: []string{"TMKMS_RECONNECT_JITTER=0.5"},
+			want: func(cfg *CoConfig) {
+				jitter := 0.5
+				cfg.Reconnect.Jitter = &jitter
+			},
+		},
+		{
+			name:    "indexed",
+			environ: []string{"TMKMS_NODE_0_ADDRESS=tcp://10.0.0.9:1234", "TMKMS_COSIGNER_0_REMOTE_ADDRESS=tcp://10.0.1.9:2222"},
+			want: func(cfg *CoConfig) {
+				cfg.Nodes[0].Address = "tcp://10.0.0.9:1234"
+				cfg.Cosigners[0].Address = "tcp://10.0.1.9:2222"
+			},
+		},
+		{
+			name:    "indexed append",
+			environ: []string{"TMKMS_NODE_1_ADDRESS=tcp://10.0.0.2:1234", "TMKMS_COSIGNER_1_ID=3", "TMKMS_COSIGNER_1_REMOTE_ADDRESS=tcp://10.0.1.3:2222"},
+			want: func(cfg *CoConfig) {
+				cfg.Nodes = append(cfg.Nodes, NodeConfig{Address: "tcp://10.0.0.2:1234"})
+				cfg.Cosigners = append(cfg.Cosigners, CosignerConfig{ID: 3, Address: "tcp://10.0.1.3:2222"})
+			},
+		},
+		{
+			name:    "nested list append",
+			environ: []string{"TMKMS_CHAIN_0_CHAIN_ID=chain-2", "TMKMS_CHAIN_0_NODE_0_ADDRESS=tcp://10.0.2.1:1234"},
+			want: func(cfg *CoConfig) {
+				cfg.Chains = []ChainConfig{{ChainID: "chain-2", Nodes: []NodeConfig{{Address: "tcp://10.0.2.1:1234"}}}}
+			},
+		},
+		{
+			name:    "file",
+			environ: []string{"TMKMS_NODE_0_ADDRESS_FILE=" + secret},
+			want: func(cfg *CoConfig) {
+				cfg.Nodes[0].Address = "tcp://10.0.0.2:1234"
+			},
+		},
+		{
+			name:    "missing file",
+			environ: []string{"TMKMS_NODE_0_ADDRESS_FILE=" + filepath.Join(dir, "missing")},
+			err:     "TMKMS_NODE_0_ADDRESS_FILE",
+		},
+		{
+			name:    "invalid value",
+			environ: []string{"TMKMS_SESSION_TIMEOUT_SEC=soon"},
+			err:     "TMKMS_SESSION_TIMEOUT_SEC",
+		},
+		{
+			name:    "gap in a list",
+			environ: []string{"TMKMS_NODE_2_ADDRESS=tcp://10.0.0.3:1234"},
+			err:     "TMKMS_NODE_2_ADDRESS",
+		},
+		{
+			name:    "misspelled",
+			environ: []string{"TMKMS_CHAINID=chain-2", "TMKMS_NODE_0_ADRESS=tcp://10.0.0.9:1234"},
+			err:     "TMKMS_CHAINID, TMKMS_NODE_0_ADRESS",
+		},
+		{
+			name:    "value and file",
+			environ: []string{"TMKMS_CHAIN_ID=chain-2", "TMKMS_CHAIN_ID_FILE=" + secret},
+			err:     "TMKMS_CHAIN_ID_FILE",
+		},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			cfg := base()
+			err := cfg.ApplyEnv(c.environ)
+			if c.err != "" {
+				if err == nil || !strings.Contains(err.Error(), c.err) {
+					t.Fatalf("got error %v, want one naming %s", err, c.err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			want := base()
+			c.want(&want)
+			if !reflect.DeepEqual(cfg, want) {
+				t.Errorf("got config %+v, want %+v", cfg, want)
+			}
+		})
+	}
+}
@@ -0,0 +1,233 @@
+package signer
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/taurusgroup/frost-ed25519/pkg/state"
+)
+
+// Sentinel errors of the signer. The errors returned by the signer either are
+// or wrap one of these, so they can be told apart with errors.Is.
+var (
+	// safety refusals: signing would risk a double sign
+	ErrRegression       = errors.New("HRS regression")
+	ErrDoubleSign       = errors.New("double-sign attempt")
+	ErrSignedBefore     = errors.New("signed before")
+	ErrNoSignBytes      = errors.New("no SignBytes found")
+	ErrWrongChainID     = errors.New("wrong chain ID")
+	ErrInvalidSignBytes = errors.New("could not UnpackHRS from sign bytes")
+	ErrInvalidSignature = errors.New("invalid signature")
+
+	// liveness failures: the signature could not be produced in time
+	ErrInsufficientQuorum = errors.New("not enough messages collected")
+	ErrTimeout            = errors.New("timeout")
+	ErrUnexpectedReply    = errors.New("unexpected reply")
+	ErrSessionInProgress  = errors.New("already being signed on")
+	ErrInvalidSession     = errors.New("invalid session")
+	ErrProtocol           = errors.New("threshold signing protocol failed")
+	ErrPaused             = errors.New("signing is paused")
+	ErrUnknownCommitment  = errors.New("unknown or already used nonce commitment")
+	ErrTooManySessions    = errors.New("too many signing sessions")
+	ErrTooFarAhead        = errors.New("session too far ahead of the last signature")
+	ErrInvalidPartySet    = errors.New("invalid party set")
+	ErrInvalidRequest     = errors.New("malformed request")
+	ErrShuttingDown       = errors.New("signer is shutting down")
+	ErrAuditLog           = errors.New("cannot write the audit log")
+)
+
+// Error classes, telling a safety refusal from a liveness failure
+const (
+	ErrorClassSafety   = "safety"
+	ErrorClassLiveness = "liveness"
+	ErrorClassOther    = "other"
+)
+
+type errorKind struct {
+	err    error
+	code   int32
+	reason string
+	class  string
+}
+
+// errorKinds maps the sentinel errors to RemoteSignerError codes and metric labels.
+// Codes are part of the protocol with the nodes and must not be changed.
+var errorKinds = []errorKind{
+	{ErrRegression, 1, "regression", ErrorClassSafety},
+	{ErrDoubleSign, 2, "double_sign", ErrorClassSafety},
+	{ErrSignedBefore, 3, "signed_before", ErrorClassSafety},
+	{ErrNoSignBytes, 4, "no_sign_bytes", ErrorClassSafety},
+	{ErrWrongChainID, 5, "wrong_chain_id", ErrorClassSafety},
+	{ErrInvalidSignBytes, 6, "invalid_sign_bytes", ErrorClassSafety},
+	{ErrInvalidSignature, 7, "invalid_signature", ErrorClassSafety},
+	{ErrInsufficientQuorum, 20, "insufficient_quorum", ErrorClassLiveness},
+	{ErrTimeout, 21, "timeout", ErrorClassLiveness},
+	{ErrUnexpectedReply, 22, "unexpected_reply", ErrorClassLiveness},
+	{ErrSessionInProgress, 23, "session_in_progress", ErrorClassLiveness},
+	{ErrInvalidSession, 24, "invalid_session", ErrorClassLiveness},
+	{ErrProtocol, 25, "protocol", ErrorClassLiveness},
+	{ErrPaused, 26, "paused", ErrorClassLiveness},
+	{ErrUnknownCommitment, 27, "unknown_commitment", ErrorClassLiveness},
+	{ErrTooManySessions, 28, "too_many_sessions", ErrorClassLiveness},
+	{ErrTooFarAhead, 29, "too_far_ahead", ErrorClassLiveness},
+	{ErrInvalidPartySet, 30, "invalid_party_set", ErrorClassLiveness},
+	{ErrInvalidRequest, 31, "invalid_request", ErrorClassLiveness},
+	{ErrShuttingDown, 32, "shutting_down", ErrorClassLiveness},
+	{ErrAuditLog, 33, "audit_log", ErrorClassLiveness},
+}
+
+func findErrorKind(err error) (errorKind, bool) {
+	for _, kind := range errorKinds {
+		if errors.Is(err, kind.err) {
+			return kind, true
+		}
+	}
+	return errorKind{}, false
+}
+
+// ErrorCode returns the RemoteSignerError code for the error, or 0 if it is not one of the signer's errors
+func ErrorCode(err error) int32 {
+	kind, _ := findErrorKind(err)
+	return kind.code
+}
+
+// ErrorReason returns a low-cardinality metric label for the error
+func ErrorReason(err error) string {
+	if err == nil {
+		return ""
+	}
+	if kind, ok := findErrorKind(err); ok {
+		return kind.reason
+	}
+	return "other"
+}
+
+// ErrorClass returns whether the error is a safety refusal or a liveness failure
+func ErrorClass(err error) string {
+	if err == nil {
+		return ""
+	}
+	if kind, ok := findErrorKind(err); ok {
+		return kind.class
+	}
+	return ErrorClassOther
+}
+
+// RegressionError is returned for requests with a height, round or step
+// lower than that of the last signature
+type RegressionError struct {
+	Height     int64
+	Round      int64
+	Step       int8
+	LastHeight int64
+	LastRound  int64
+	LastStep   int8
+}
+
+func (e *RegressionError) Error() string {
+	if e.Height < e.LastHeight {
+		return fmt.Sprintf("height regression. Got %v, last height %v", e.Height, e.LastHeight)
+	}
+	if e.Round < e.LastRound {
+		return fmt.Sprintf("round regression at height %v. Got %v, last round %v", e.Height, e.Round, e.LastRound)
+	}
+	return fmt.Sprintf("step regression at height %v round %v. Got %v, last step %v", e.Height, e.Round, e.Step, e.LastStep)
+}
+
+func (e *RegressionError) Is(target error) bool {
+	return target == ErrRegression
+}
+
+// LookaheadError is returned for sessions a peer opens too far above the reference height
+type LookaheadError struct {
+	Height    int64
+	Reference int64
+	Lookahead int64
+}
+
+func (e *LookaheadError) Error() string {
+	return fmt.Sprintf("session at height %v too far ahead of height %v (at most %v heights ahead)", e.Height, e.Reference, e.Lookahead)
+}
+
+func (e *LookaheadError) Is(target error) bool {
+	return target == ErrTooFarAhead
+}
+
+// PartySetError is returned for requests with a malformed party set
+type PartySetError struct {
+	PartyIDs []byte
+	Reason   string
+}
+
+func (e *PartySetError) Error() string {
+	return fmt.Sprintf("invalid party set %v: %s", e.PartyIDs, e.Reason)
+}
+
+func (e *PartySetError) Is(target error) bool {
+	return target == ErrInvalidPartySet
+}
+
+// ChainIDError is returned for sign bytes of a chain the cosigner does not sign for
+type ChainIDError struct {
+	ChainID string
+	// the chain ID of the cosigner; empty if no cosigner serves ChainID
+	Expected string
+}
+
+func (e *ChainIDError) Error() string {
+	if e.Expected == "" {
+		return fmt.Sprintf("unknown chain ID %q", e.ChainID)
+	}
+	return fmt.Sprintf("wrong chain ID %q, expected %q", e.ChainID, e.Expected)
+}
+
+func (e *ChainIDError) Is(target error) bool {
+	return target == ErrWrongChainID
+}
+
+// QuorumError is returned when fewer cosigners than the threshold plus one took part in a round
+type QuorumError struct {
+	Collected int
+	Required  int
+}
+
+func (e *QuorumError) Error() string {
+	return fmt.Sprintf("not enough messages collected: %d of %d", e.Collected, e.Required)
+}
+
+func (e *QuorumError) Is(target error) bool {
+	return target == ErrInsufficientQuorum
+}
+
+// ProtocolError wraps an error of the FROST signing protocol
+type ProtocolError struct {
+	// the cosigner whose message made the protocol fail, 0 if the failure
+	// cannot be attributed to a single cosigner
+	Culprit byte
+	Err     error
+}
+
+// newProtocolError wraps an error of the FROST state, attributing it to the party the state blames
+func newProtocolError(err error) *ProtocolError {
+	protocolErr := &ProtocolError{Err: err}
+	var stateErr *state.Error
+	if errors.As(err, &stateErr) {
+		protocolErr.Culprit = byte(stateErr.PartyID)
+	}
+	return protocolErr
+}
+
+func (e *ProtocolError) Error() string {
+	if e.Culprit != 0 {
+		return fmt.Sprintf("threshold signing protocol failed: cosigner %d misbehaved: %v", e.Culprit, e.Err)
+	}
+	return fmt.Sprintf("threshold signing protocol failed: %v", e.Err)
+}
+
+func (e *ProtocolError) Is(target error) bool {
+	return target == ErrProtocol
+}
+
+func (e *ProtocolError) Unwrap() error {
+	return e.Err
+}
@@ -0,0 +1,385 @@
+package signer
+
+import (
+	"context"
+	"fmt"
+	"math/rand"
+	"sync"
+	"time"
+)
+
+// ChaosConfig enables the injection of faults into the requests to the peer cosigners
+// and the replies to the nodes, to see how a staging cluster copes with an unreliable network.
+// Never enable it in production.
+type ChaosConfig struct {
+	Enabled bool `toml:"enabled"`
+	// seed of the fault decisions, to replay a run; a random one if 0
+	Seed  int64             `toml:"seed"`
+	Peers []PeerFaultConfig `toml:"peer"`
+	Nodes []NodeFaultConfig `toml:"node"`
+}
+
+// PeerFaultConfig gives the faults of the requests to a peer cosigner,
+// or to all the peers without an entry of their own if ID is 0
+type PeerFaultConfig struct {
+	ID int `toml:"id"`
+	FaultConfig
+}
+
+// NodeFaultConfig gives the faults of the replies to a node,
+// or to all the nodes without an entry of their own if Address is empty
+type NodeFaultConfig struct {
+	Address string `toml:"address"`
+	FaultConfig
+}
+
+// FaultConfig gives the probability of each fault per request, and its latencies.
+// At most one of the crash, drop, garbage and reorder faults hits a request,
+// so their probabilities add up to at most 1; a delay may come on top of any of them.
+type FaultConfig struct {
+	// the request is not sent, or not handled for a node
+	DropRequest float64 `toml:"drop_request"`
+	// the request is handled but its reply is lost
+	DropReply float64 `toml:"drop_reply"`
+	// the reply is replaced with random bytes
+	Garbage float64 `toml:"garbage"`
+	// the previous reply is delivered again in place of the reply
+	Reorder float64 `toml:"reorder"`
+	// the peer or node handles the request, then goes down for crash_duration_ms
+	Crash           float64 `toml:"crash"`
+	CrashDurationMs int     `toml:"crash_duration_ms"`
+	// the reply is held back for between delay_min_ms and delay_max_ms
+	Delay      float64 `toml:"delay"`
+	DelayMinMs int     `toml:"delay_min_ms"`
+	DelayMaxMs int     `toml:"delay_max_ms"`
+}
+
+// Fault is a fault injected into a request
+type Fault int
+
+const (
+	FaultNone Fault = iota
+	FaultDropRequest
+	FaultDropReply
+	FaultGarbage
+	FaultReorder
+	FaultCrash
+	// the peer or node is down after a crash
+	FaultDown
+	FaultDelay
+)
+
+func (fault Fault) String() string {
+	switch fault {
+	case FaultDropRequest:
+		return "drop_request"
+	case FaultDropReply:
+		return "drop_reply"
+	case FaultGarbage:
+		return "garbage"
+	case FaultReorder:
+		return "reorder"
+	case FaultCrash:
+		return "crash"
+	case FaultDown:
+		return "down"
+	case FaultDelay:
+		return "delay"
+	}
+	return "none"
+}
+
+// validate returns the problems of the fault config
+func (cfg FaultConfig) validate() []string {
+	var problems []string
+	probabilities := []struct {
+		name  string
+		value float64
+	}{
+		{"drop_request", cfg.DropRequest},
+		{"drop_reply", cfg.DropReply},
+		{"garbage", cfg.Garbage},
+		{"reorder", cfg.Reorder},
+		{"crash", cfg.Crash},
+		{"delay", cfg.Delay},
+	}
+	for _, p := range probabilities {
+		if p.value < 0 || p.value > 1 {
+			problems = append(problems, fmt.Sprintf("%s: %v is not a probability", p.name, p.value))
+		}
+	}
+	if sum := cfg.DropRequest + cfg.DropReply + cfg.Garbage + cfg.Reorder + cfg.Crash; sum > 1 {
+		problems = append(problems, fmt.Sprintf("drop_request, drop_reply, garbage, reorder and crash add up to %v, more than 1", sum))
+	}
+	if cfg.CrashDurationMs < 0 || cfg.DelayMinMs < 0 || cfg.DelayMaxMs < 0 {
+		problems = append(problems, "latencies must not be negative")
+	}
+	if cfg.DelayMinMs > cfg.DelayMaxMs {
+		problems = append(problems, fmt.Sprintf("delay_min_ms %d is above delay_max_ms %d", cfg.DelayMinMs, cfg.DelayMaxMs))
+	}
+	return problems
+}
+
+// validate returns the problems of the chaos config
+func (cfg ChaosConfig) validate() []string {
+	var problems []string
+	peers := make(map[int]bool)
+	for i, peer := range cfg.Peers {
+		if peers[peer.ID] {
+			problems = append(problems, fmt.Sprintf("chaos.peer[%d]: duplicate id %d", i, peer.ID))
+		}
+		peers[peer.ID] = true
+		for _, problem := range peer.validate() {
+			problems = append(problems, fmt.Sprintf("chaos.peer[%d]: %s", i, problem))
+		}
+	}
+	nodes := make(map[string]bool)
+	for i, node := range cfg.Nodes {
+		if nodes[node.Address] {
+			problems = append(problems, fmt.Sprintf("chaos.node[%d]: duplicate address %q", i, node.Address))
+		}
+		nodes[node.Address] = true
+		for _, problem := range node.validate() {
+			problems = append(problems, fmt.Sprintf("chaos.node[%d]: %s", i, problem))
+		}
+	}
+	return problems
+}
+
+// FaultInjector decides the faults injected into the requests to the peers and the replies
+// to the nodes. A nil FaultInjector injects no faults. It is safe for concurrent use.
+type FaultInjector struct {
+	mtx      sync.Mutex
+	rand     *rand.Rand
+	peers    map[byte]FaultConfig
+	nodes    map[string]FaultConfig
+	targets  map[string]*faultTarget
+	injected map[Fault]int
+}
+
+// faultTarget is the state of the faults of a peer or node
+type faultTarget struct {
+	downUntil time.Time
+	// last reply delivered by a peer, delivered again by a reorder fault
+	last [][]byte
+}
+
+// faultPlan is the fault decided for a request
+type faultPlan struct {
+	injector *FaultInjector
+	target   *faultTarget
+	label    string
+	fault    Fault
+	delay    time.Duration
+}
+
+// crashDuration returns how long the target is down after the crash of the request
+func (plan faultPlan) crashDuration() time.Duration {
+	plan.injector.mtx.Lock()
+	defer plan.injector.mtx.Unlock()
+	return time.Until(plan.target.downUntil)
+}
+
+// NewFaultInjector returns the fault injector of the config, nil if chaos is not enabled
+func NewFaultInjector(cfg ChaosConfig) *FaultInjector {
+	if !cfg.Enabled {
+		return nil
+	}
+	seed := cfg.Seed
+	if seed == 0 {
+		seed = time.Now().UnixNano()
+	}
+	faults := &FaultInjector{
+		rand:     rand.New(rand.NewSource(seed)),
+		peers:    make(map[byte]FaultConfig),
+		nodes:    make(map[string]FaultConfig),
+		targets:  make(map[string]*faultTarget),
+		injected: make(map[Fault]int),
+	}
+	for _, peer := range cfg.Peers {
+		faults.peers[byte(peer.ID)] = peer.FaultConfig
+	}
+	for _, node := range cfg.Nodes {
+		faults.nodes[node.Address] = node.FaultConfig
+	}
+	return faults
+}
+
+// SetPeerFaults sets the faults of the requests to the peer, or to all peers without
+// faults of their own if id is 0
+func (faults *FaultInjector) SetPeerFaults(id byte, cfg FaultConfig) {
+	faults.mtx.Lock()
+	defer faults.mtx.Unlock()
+	faults.peers[id] = cfg
+}
+
+// SetNodeFaults sets the faults of the replies to the node, or to all nodes without
+// faults of their own if address is empty
+func (faults *FaultInjector) SetNodeFaults(address string, cfg FaultConfig) {
+	faults.mtx.Lock()
+	defer faults.mtx.Unlock()
+	faults.nodes[address] = cfg
+}
+
+// Injected returns how many faults of each kind were injected
+func (faults *FaultInjector) Injected() map[Fault]int {
+	if faults == nil {
+		return nil
+	}
+	faults.mtx.Lock()
+	defer faults.mtx.Unlock()
+	injected := make(map[Fault]int, len(faults.injected))
+	for fault, n := range faults.injected {
+		injected[fault] = n
+	}
+	return injected
+}
+
+// peerFault decides the fault of a request to the peer
+func (faults *FaultInjector) peerFault(id byte) faultPlan {
+	if faults == nil {
+		return faultPlan{}
+	}
+	faults.mtx.Lock()
+	defer faults.mtx.Unlock()
+	cfg, ok := faults.peers[id]
+	if !ok {
+		cfg = faults.peers[0]
+	}
+	return faults.plan(cfg, "peer:"+peerLabel(id))
+}
+
+// nodeFault decides the fault of a request from the node
+func (faults *FaultInjector) nodeFault(address string) faultPlan {
+	if faults == nil {
+		return faultPlan{}
+	}
+	faults.mtx.Lock()
+	defer faults.mtx.Unlock()
+	cfg, ok := faults.nodes[address]
+	if !ok {
+		cfg = faults.nodes[""]
+	}
+	return faults.plan(cfg, "node:"+address)
+}
+
+// plan decides the fault of a request to the target. It must be called with the mutex held.
+func (faults *FaultInjector) plan(cfg FaultConfig, label string) faultPlan {
+	target, ok := faults.targets[label]
+	if !ok {
+		target = &faultTarget{}
+		faults.targets[label] = target
+	}
+	plan := faultPlan{injector: faults, target: target, label: label}
+	now := time.Now()
+	if now.Before(target.downUntil) {
+		plan.fault = FaultDown
+		faults.record(plan.label, FaultDown)
+		return plan
+	}
+
+	r := faults.rand.Float64()
+	for _, candidate := range []struct {
+		fault       Fault
+		probability float64
+	}{
+		{FaultCrash, cfg.Crash},
+		{FaultDropRequest, cfg.DropRequest},
+		{FaultDropReply, cfg.DropReply},
+		{FaultGarbage, cfg.Garbage},
+		{FaultReorder, cfg.Reorder},
+	} {
+		if r < candidate.probability {
+			plan.fault = candidate.fault
+			break
+		}
+		r -= candidate.probability
+	}
+	if plan.fault == FaultCrash {
+		target.downUntil = now.Add(time.Duration(cfg.CrashDurationMs) * time.Millisecond)
+	}
+	if plan.fault != FaultNone {
+		faults.record(plan.label, plan.fault)
+	}
+
+	if faults.rand.Float64() < cfg.Delay {
+		delay := time.Duration(cfg.DelayMinMs) * time.Millisecond
+		if spread := cfg.DelayMaxMs - cfg.DelayMinMs; spread > 0 {
+			delay += time.Duration(faults.rand.Intn(spread+1)) * time.Millisecond
+		}
+		plan.delay = delay
+		faults.record(plan.label, FaultDelay)
+	}
+	return plan
+}
+
+// record counts an injected fault. It must be called with the mutex held.
+func (faults *FaultInjector) record(label string, fault Fault) {
+	faults.injected[fault]++
+	metricFaultsInjected.WithLabelValues(label, fault.String()).Inc()
+}
+
+// dropsRequest is true if the request must not be sent or handled
+func (plan faultPlan) dropsRequest() bool {
+	return plan.fault == FaultDropRequest || plan.fault == FaultDown
+}
+
+// dropsReply is true if the reply to the request must not be delivered
+func (plan faultPlan) dropsReply() bool {
+	return plan.fault == FaultDropReply || plan.fault == FaultCrash
+}
+
+// garbage returns random frames in place of a reply
+func (plan faultPlan) garbage() [][]byte {
+	plan.injector.mtx.Lock()
+	defer plan.injector.mtx.Unlock()
+	frames := make([][]byte, 1+plan.injector.rand.Intn(4))
+	for i := range frames {
+		frames[i] = make([]byte, plan.injector.rand.Intn(65))
+		plan.injector.rand.Read(frames[i])
+	}
+	return frames
+}
+
+// stale returns the last reply delivered by the peer, garbage if there is none
+func (plan faultPlan) stale() [][]byte {
+	plan.injector.mtx.Lock()
+	last := plan.target.last
+	plan.injector.mtx.Unlock()
+	if last == nil {
+		return plan.garbage()
+	}
+	return last
+}
+
+// reply applies the fault to the reply of a peer received before the deadline of its request.
+// Waiting for the deadline or the delay is cut short once the context is done.
+func (plan faultPlan) reply(ctx context.Context, reply [][]byte, deadline time.Time) ([][]byte, error) {
+	switch {
+	case plan.dropsReply():
+		if !sleep(ctx, time.Until(deadline)) {
+			return nil, ErrShuttingDown
+		}
+		return nil, ErrTimeout
+	case plan.fault == FaultGarbage:
+		reply = plan.garbage()
+	case plan.fault == FaultReorder:
+		reply = plan.stale()
+	case plan.target != nil:
+		plan.injector.mtx.Lock()
+		plan.target.last = reply
+		plan.injector.mtx.Unlock()
+	}
+	if plan.delay > 0 {
+		if time.Now().Add(plan.delay).After(deadline) {
+			if !sleep(ctx, time.Until(deadline)) {
+				return nil, ErrShuttingDown
+			}
+			return nil, ErrTimeout
+		}
+		if !sleep(ctx, plan.delay) {
+			return nil, ErrShuttingDown
+		}
+	}
+	return reply, nil
+}
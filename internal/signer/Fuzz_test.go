@@ -0,0 +1,80 @@
+//go:build go1.18
+// +build go1.18
+
+package signer
+
+import (
+	"encoding/binary"
+	"errors"
+	"testing"
+)
+
+// The seed corpus is in testdata/fuzz. Run a target with e.g.
+//
+//	go test -run '^$' -fuzz FuzzMsgToRequest ./internal/signer
+
+// splitFrames cuts fuzz input into message frames, each prefixed by its length as a uvarint.
+// A truncated last frame takes the rest of the input.
+func splitFrames(data []byte) [][]byte {
+	var frames [][]byte
+	for len(data) > 0 {
+		n, size := binary.Uvarint(data)
+		if size <= 0 {
+			return append(frames, data)
+		}
+		data = data[size:]
+		if n > uint64(len(data)) {
+			n = uint64(len(data))
+		}
+		frames = append(frames, data[:n])
+		data = data[n:]
+	}
+	return frames
+}
+
+func FuzzMsgToRequest(f *testing.F) {
+	f.Fuzz(func(t *testing.T, data []byte) {
+		req, err := MsgToRequest(splitFrames(data))
+		if err != nil {
+			if req != nil {
+				t.Fatalf("request %#v returned with error %v", req, err)
+			}
+			if !errors.Is(err, ErrInvalidRequest) {
+				t.Fatalf("error %v is not ErrInvalidRequest", err)
+			}
+			return
+		}
+		if req == nil {
+			t.Fatal("no request and no error")
+		}
+		// requests are routed by their sign bytes
+		UnpackHRS(req.GetSignBytes())
+	})
+}
+
+func FuzzUnpackHRS(f *testing.F) {
+	f.Fuzz(func(t *testing.T, signBytes []byte) {
+		_, _, step, _, err := UnpackHRS(signBytes)
+		if err != nil {
+			if !errors.Is(err, ErrInvalidSignBytes) {
+				t.Fatalf("error %v is not ErrInvalidSignBytes", err)
+			}
+			return
+		}
+		if step != stepPropose && step != stepPrevote && step != stepPrecommit {
+			t.Fatalf("unknown step %d", step)
+		}
+		if _, ok := CheckOnlyDifferByTimestamp(step, signBytes, signBytes); !ok {
+			t.Fatal("sign bytes differ from themselves")
+		}
+	})
+}
+
+func FuzzCheckOnlyDifferByTimestamp(f *testing.F) {
+	f.Fuzz(func(t *testing.T, step int8, lastSignBytes []byte, newSignBytes []byte) {
+		_, ok := CheckOnlyDifferByTimestamp(step, lastSignBytes, newSignBytes)
+		if _, reverse := CheckOnlyDifferByTimestamp(step, newSignBytes, lastSignBytes); ok != reverse {
+			t.Fatalf("comparison is not symmetric: %v one way, %v the other", ok, reverse)
+		}
+	})
+}
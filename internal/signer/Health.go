@@ -0,0 +1,137 @@
+package signer
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"time"
+)
+
+// how long readiness probes wait for the peers to answer a ping
+const healthPingTimeout = time.Second
+
+// HealthCheck is the state of one dependency of the signer
+type HealthCheck struct {
+	Name   string `json:"name"`
+	OK     bool   `json:"ok"`
+	Detail string `json:"detail,omitempty"`
+}
+
+// HealthReport is the response body of the health endpoints
+type HealthReport struct {
+	Status string        `json:"status"`
+	Checks []HealthCheck `json:"checks,omitempty"`
+}
+
+// HealthChecker serves /healthz and /readyz for the signer process.
+//
+// The signer is ready when for every chain the key share is loaded,
+// the sign state is readable and at least one node is connected,
+// and at least Threshold peer cosigners answer a ping.
+type HealthChecker struct {
+	chains []*Chain
+}
+
+// NewHealthChecker returns a HealthChecker for the chains
+func NewHealthChecker(chains []*Chain) *HealthChecker {
+	return &HealthChecker{chains: chains}
+}
+
+// Register adds the health endpoints to the mux
+func (hc *HealthChecker) Register(mux *http.ServeMux) {
+	mux.HandleFunc("/healthz", hc.serveHealth)
+	mux.HandleFunc("/readyz", hc.serveReady)
+}
+
+// Readiness runs all the readiness checks
+func (hc *HealthChecker) Readiness() HealthReport {
+	report := HealthReport{Status: "ok"}
+	for _, chain := range hc.chains {
+		report.Checks = append(report.Checks, checkKeyShare(chain.Local), checkSignState(chain.Local), checkNodes(chain))
+	}
+	if len(hc.chains) > 0 {
+		// all chains share the same peers
+		report.Checks = append(report.Checks, checkCosigners(hc.chains[0].Peers))
+	}
+	for _, check := range report.Checks {
+		if !check.OK {
+			report.Status = "unavailable"
+		}
+	}
+	return report
+}
+
+func checkKeyShare(local *LocalCosigner) HealthCheck {
+	check := HealthCheck{Name: "key_share/" + local.ChainID()}
+	if local.kgOutput.Secret == nil || local.kgOutput.Shares == nil {
+		check.Detail = "key share not loaded"
+		return check
+	}
+	check.OK = true
+	return check
+}
+
+func checkSignState(local *LocalCosigner) HealthCheck {
+	check := HealthCheck{Name: "sign_state/" + local.ChainID()}
+	state, err := LoadSignState(local.lastSignState.filePath)
+	if err != nil {
+		check.Detail = err.Error()
+		return check
+	}
+	check.OK = true
+	check.Detail = fmt.Sprintf("height %d round %d step %d", state.Height, state.Round, state.Step)
+	return check
+}
+
+func checkNodes(chain *Chain) HealthCheck {
+	check := HealthCheck{Name: "nodes/" + chain.ChainID()}
+	nodes := chain.Nodes()
+	connected := 0
+	for _, node := range nodes {
+		if node.IsConnected() {
+			connected++
+		}
+	}
+	check.OK = connected > 0
+	check.Detail = fmt.Sprintf("%d of %d connected", connected, len(nodes))
+	return check
+}
+
+func checkCosigners(peers *RemoteCosigners) HealthCheck {
+	check := HealthCheck{Name: "cosigners"}
+	pings := peers.Ping(healthPingTimeout)
+	ids := make([]int, 0, len(pings))
+	for id := range pings {
+		ids = append(ids, int(id))
+	}
+	sort.Ints(ids)
+	answered := 0
+	failed := ""
+	for _, id := range ids {
+		if err := pings[byte(id)]; err != nil {
+			failed += fmt.Sprintf("; cosigner %d: %v", id, err)
+		} else {
+			answered++
+		}
+	}
+	check.OK = answered >= peers.Threshold
+	check.Detail = fmt.Sprintf("%d of %d answered, %d required%s", answered, len(pings), peers.Threshold, failed)
+	return check
+}
+
+func (hc *HealthChecker) serveHealth(w http.ResponseWriter, r *http.Request) {
+	writeHealthReport(w, HealthReport{Status: "ok"})
+}
+
+func (hc *HealthChecker) serveReady(w http.ResponseWriter, r *http.Request) {
+	writeHealthReport(w, hc.Readiness())
+}
+
+func writeHealthReport(w http.ResponseWriter, report HealthReport) {
+	w.Header().Set("Content-Type", "application/json")
+	if report.Status != "ok" {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}
+	json.NewEncoder(w).Encode(report)
+}
@@ -0,0 +1,76 @@
+package signer
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"os"
+	"time"
+
+	tmlog "github.com/tendermint/tendermint/libs/log"
+	tmService "github.com/tendermint/tendermint/libs/service"
+)
+
+// HttpServer serves the HTTP endpoints of the signer registered on its Mux,
+// such as the Prometheus metrics, the health checks and the admin API.
+type HttpServer struct {
+	tmService.BaseService
+	Mux *http.ServeMux
+
+	network string
+	address string
+	server  *http.Server
+}
+
+// NewHttpServer returns an HttpServer that will listen on the given network ("tcp" or "unix") and address
+func NewHttpServer(logger tmlog.Logger, network string, address string) *HttpServer {
+	mux := http.NewServeMux()
+	hs := &HttpServer{
+		Mux:     mux,
+		network: network,
+		address: address,
+		server: &http.Server{
+			Handler:      mux,
+			ReadTimeout:  10 * time.Second,
+			WriteTimeout: 10 * time.Second,
+		},
+	}
+	hs.BaseService = *tmService.NewBaseService(logger, "HttpServer", hs)
+	return hs
+}
+
+// OnStart implements cmn.Service.
+func (hs *HttpServer) OnStart() error {
+	if hs.network == "unix" {
+		// remove the socket left behind by an earlier process
+		if err := os.Remove(hs.address); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+	listener, err := net.Listen(hs.network, hs.address)
+	if err != nil {
+		return err
+	}
+	if hs.network == "unix" {
+		if err := os.Chmod(hs.address, 0600); err != nil {
+			listener.Close()
+			return err
+		}
+	}
+	go func() {
+		if err := hs.server.Serve(listener); err != nil && err != http.ErrServerClosed {
+			hs.Logger.Error("Serve", "err", err)
+		}
+	}()
+	hs.Logger.Info("Listening", "network", hs.network, "address", hs.address)
+	return nil
+}
+
+// OnStop implements cmn.Service.
+func (hs *HttpServer) OnStop() {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := hs.server.Shutdown(ctx); err != nil {
+		hs.Logger.Error("Shutdown", "err", err)
+	}
+}
@@ -4,6 +4,7 @@ package signer
 
 import (
 	"bytes"
+	"context"
 	"errors"
 	"fmt"
 	"sort"
@@ -15,6 +16,8 @@ import (
 	"github.com/taurusgroup/frost-ed25519/pkg/frost/sign"
 	"github.com/taurusgroup/frost-ed25519/pkg/helpers"
 	"github.com/taurusgroup/frost-ed25519/pkg/state"
+	"github.com/tendermint/tendermint/crypto"
+	tmcrypto "github.com/tendermint/tendermint/crypto/ed25519"
 )
 
 type HRSKey struct {
@@ -53,29 +56,44 @@ func (hrsKey *HRSKey) Less(other HRSKey) bool {
 	return false
 }
 
+// SortedPartyIds is the key of a session among those of its HRS.
+// Each coordinator has its own sessions: nodes of different cosigners
+// request the same HRS at the same time, and may pick the same party set.
 type SortedPartyIds struct {
-	Ids string
+	Coordinator byte
+	Ids         string
 }
 
-func getSortedPartyIds(ids []byte) SortedPartyIds {
+// getSortedPartyIds returns the key of the coordinator's session with the party set; the IDs are left untouched
+func getSortedPartyIds(coordinator byte, partyIDs []byte) SortedPartyIds {
+	ids := append([]byte(nil), partyIDs...)
 	sort.Slice(ids, func(i, j int) bool {
 		return ids[i] < ids[j]
 	})
 	return SortedPartyIds{
-		Ids: fmt.Sprintf("%v", ids),
+		Coordinator: coordinator,
+		Ids:         fmt.Sprintf("%v", ids),
 	}
 }
 
+// HRSMeta is a signing session. Sessions of preprocessed signing have no state,
+// they only record that our share of their sign bytes was handed out.
 type HRSMeta struct {
 	state            *state.State
 	output           *sign.Output
 	currentSignBytes []byte
 	expirationTime   time.Time
+	// set once our signature share was handed out by EndSession
+	released bool
 }
 
 // LocalCosigner responds to sign requests using their share key
 // The cosigner maintains a watermark to avoid double-signing
 //
+// Sessions of different HRS may run concurrently and finish in any order.
+// The watermark only moves up: new sessions below it are refused, and a session
+// finishing below it does not lower it.
+//
 // LocalCosigner signing is thread saafe
 type LocalCosigner struct {
 	kgOutput KeyGenOutput
@@ -86,24 +104,46 @@ type LocalCosigner struct {
 	// signing is thread safe
 	lastSignStateMutex sync.Mutex
 
-	sessions map[HRSKey]map[SortedPartyIds]HRSMeta
+	sessions *SessionStore
 	timeout  time.Duration
 	chainId  string
+	// highest height our own nodes requested a signature for
+	referenceHeight int64
+
+	audit *AuditLog
+	// set while signing is paused by the operator
+	paused bool
+	// set by Close, after which signing is refused for good
+	closed bool
+
+	// nonces of the commitments handed out for preprocessed signing, created on first use
+	nonces *noncePool
 }
 
-func getSession(m map[SortedPartyIds]HRSMeta) *HRSMeta {
-	for _, v := range m {
-		return &v
-	}
-	return nil
+// SessionInfo describes a signing session held by the local cosigner
+type SessionInfo struct {
+	Height      int64     `json:"height"`
+	Round       int64     `json:"round"`
+	Step        int8      `json:"step"`
+	Coordinator byte      `json:"coordinator"`
+	PartyIDs    string    `json:"party_ids"`
+	Finished    bool      `json:"finished"`
+	ExpiresAt   time.Time `json:"expires_at"`
 }
 
-func NewLocalCosigner(cfg CoConfig) (*LocalCosigner, error) {
-	kgOutput, err := LoadKeygenOutputFromFile(cfg.KeySharePath)
+// NewLocalCosigner creates the local cosigner for one of the chains in the config
+func NewLocalCosigner(cfg CoConfig, chain ChainConfig) (*LocalCosigner, error) {
+	kgOutput, err := LoadKeygenOutputFromFile(chain.KeySharePath)
 	if err != nil {
 		return nil, err
 	}
-	lastSignState, err := LoadOrCreateSignState(cfg.PrivValStateFile)
+	if kgOutput.Secret.ID != party.ID(cfg.CosignerId) {
+		return nil, fmt.Errorf("key share %s is for cosigner %d, not cosigner_id %d", chain.KeySharePath, kgOutput.Secret.ID, cfg.CosignerId)
+	}
+	if kgOutput.Shares.Threshold() != party.Size(cfg.CosignerThreshold) {
+		return nil, fmt.Errorf("key share %s has threshold %d, not cosigner_threshold %d", chain.KeySharePath, kgOutput.Shares.Threshold(), cfg.CosignerThreshold)
+	}
+	lastSignState, err := LoadOrCreateSignState(chain.PrivValStateFile)
 	if err != nil {
 		return nil, err
 	}
@@ -111,13 +151,208 @@ func NewLocalCosigner(cfg CoConfig) (*LocalCosigner, error) {
 		kgOutput:           kgOutput,
 		lastSignState:      &lastSignState,
 		lastSignStateMutex: sync.Mutex{},
-		sessions:           make(map[HRSKey]map[SortedPartyIds]HRSMeta),
+		sessions:           NewSessionStore(),
 		timeout:            time.Duration(cfg.SessionTimeoutSec * int(time.Second)),
-		chainId:            cfg.ChainID,
+		chainId:            chain.ChainID,
 	}
+	cosigner.observeSignState()
 	return cosigner, nil
 }
 
+// TestSignChainPrefix prefixes the chain IDs of test signatures, see TestSignChainID
+const TestSignChainPrefix = "tmkms-test-sign:"
+
+// TestSignChainID returns the chain ID test signatures for the chain are requested with.
+// They are served by dry-run cosigners, so they never touch the sign state of the chain.
+func TestSignChainID(chainID string) string {
+	return TestSignChainPrefix + chainID
+}
+
+// NewDryRunCosigner creates the dry-run cosigner of a chain without loading its sign state
+func NewDryRunCosigner(cfg CoConfig, chain ChainConfig) (*LocalCosigner, error) {
+	kgOutput, err := LoadKeygenOutputFromFile(chain.KeySharePath)
+	if err != nil {
+		return nil, err
+	}
+	return newDryRunCosigner(kgOutput, time.Duration(cfg.SessionTimeoutSec*int(time.Second)), chain.ChainID), nil
+}
+
+// DryRun returns a cosigner with the same key share signing for the test chain ID of the chain.
+// Its sign state is kept in memory only.
+func (cosigner *LocalCosigner) DryRun() *LocalCosigner {
+	return newDryRunCosigner(cosigner.kgOutput, cosigner.timeout, cosigner.chainId)
+}
+
+func newDryRunCosigner(kgOutput KeyGenOutput, timeout time.Duration, chainID string) *LocalCosigner {
+	lastSignState := NewMemorySignState()
+	return &LocalCosigner{
+		kgOutput:      kgOutput,
+		lastSignState: &lastSignState,
+		sessions:      NewSessionStore(),
+		timeout:       timeout,
+		chainId:       TestSignChainID(chainID),
+	}
+}
+
+// observeSignState updates the metrics for the last sign state and the held sessions
+func (cosigner *LocalCosigner) observeSignState() {
+	metricLastSignedHeight.WithLabelValues(cosigner.chainId).Set(float64(cosigner.lastSignState.Height))
+	metricLastSignedRound.WithLabelValues(cosigner.chainId).Set(float64(cosigner.lastSignState.Round))
+	metricLastSignedStep.WithLabelValues(cosigner.chainId).Set(float64(cosigner.lastSignState.Step))
+	cosigner.observeSessions()
+}
+
+// observeSessions updates the metric for the number of held sessions
+func (cosigner *LocalCosigner) observeSessions() {
+	metricLocalSessions.WithLabelValues(cosigner.chainId).Set(float64(cosigner.sessions.Len()))
+}
+
+// SetAuditLog sets the log all signing decisions are recorded in
+func (cosigner *LocalCosigner) SetAuditLog(audit *AuditLog) {
+	cosigner.lastSignStateMutex.Lock()
+	defer cosigner.lastSignStateMutex.Unlock()
+	cosigner.audit = audit
+}
+
+// recordDecision records the outcome of a request by the given party in the audit log.
+// If it cannot be recorded, the request must fail with the error returned.
+func (cosigner *LocalCosigner) recordDecision(request string, partyID byte, signBytes []byte, success string, maybeSig []byte, err error) error {
+	source := fmt.Sprintf("cosigner:%d", partyID)
+	if party.ID(partyID) == cosigner.kgOutput.Secret.ID {
+		source = "local"
+	}
+	decision := success
+	if err != nil {
+		decision = AuditRefused
+		if maybeSig != nil {
+			decision = AuditReserved
+		}
+	}
+	return cosigner.audit.Record(source, request, signBytes, decision, err)
+}
+
+// Pause makes the cosigner refuse to take part in any new signing round
+func (cosigner *LocalCosigner) Pause() {
+	cosigner.lastSignStateMutex.Lock()
+	defer cosigner.lastSignStateMutex.Unlock()
+	cosigner.paused = true
+}
+
+// Resume undoes Pause
+func (cosigner *LocalCosigner) Resume() {
+	cosigner.lastSignStateMutex.Lock()
+	defer cosigner.lastSignStateMutex.Unlock()
+	cosigner.paused = false
+}
+
+// SetTimeout changes the timeout of the sessions started from now on
+func (cosigner *LocalCosigner) SetTimeout(timeout time.Duration) {
+	cosigner.lastSignStateMutex.Lock()
+	defer cosigner.lastSignStateMutex.Unlock()
+	cosigner.timeout = timeout
+}
+
+// checkAvailable returns why the cosigner refuses to take part in signing rounds, if it does.
+// It must be called with the mutex held.
+func (cosigner *LocalCosigner) checkAvailable() error {
+	if cosigner.closed {
+		return ErrShuttingDown
+	}
+	if cosigner.paused {
+		return ErrPaused
+	}
+	return nil
+}
+
+// Close makes the cosigner refuse any further signing round and saves its sign state.
+// It is called on shutdown, once the rounds in progress are over.
+func (cosigner *LocalCosigner) Close() error {
+	cosigner.lastSignStateMutex.Lock()
+	defer cosigner.lastSignStateMutex.Unlock()
+	cosigner.closed = true
+	return cosigner.lastSignState.write()
+}
+
+// IsPaused returns whether signing is paused
+func (cosigner *LocalCosigner) IsPaused() bool {
+	cosigner.lastSignStateMutex.Lock()
+	defer cosigner.lastSignStateMutex.Unlock()
+	return cosigner.paused
+}
+
+// SignState returns a copy of the last sign state
+func (cosigner *LocalCosigner) SignState() SignState {
+	cosigner.lastSignStateMutex.Lock()
+	defer cosigner.lastSignStateMutex.Unlock()
+	return *cosigner.lastSignState
+}
+
+// Sessions returns the signing sessions currently held
+func (cosigner *LocalCosigner) Sessions() []SessionInfo {
+	cosigner.lastSignStateMutex.Lock()
+	defer cosigner.lastSignStateMutex.Unlock()
+	infos := make([]SessionInfo, 0, cosigner.sessions.Len())
+	cosigner.sessions.Each(func(hrsKey HRSKey, partyKey SortedPartyIds, session HRSMeta) {
+		infos = append(infos, SessionInfo{
+			Height:      hrsKey.Height,
+			Round:       hrsKey.Round,
+			Step:        hrsKey.Step,
+			Coordinator: partyKey.Coordinator,
+			PartyIDs:    partyKey.Ids,
+			Finished:    session.state == nil || session.state.IsFinished(),
+			ExpiresAt:   session.expirationTime,
+		})
+	})
+	sort.Slice(infos, func(i, j int) bool {
+		a := HRSKey{infos[i].Height, infos[i].Round, infos[i].Step}
+		b := HRSKey{infos[j].Height, infos[j].Round, infos[j].Step}
+		if a != b {
+			return a.Less(b)
+		}
+		if infos[i].Coordinator != infos[j].Coordinator {
+			return infos[i].Coordinator < infos[j].Coordinator
+		}
+		return infos[i].PartyIDs < infos[j].PartyIDs
+	})
+	return infos
+}
+
+// checkPartySet validates the party set of a request by the requester: it must name
+// threshold+1 distinct cosigners holding a key share, among them the requester and us
+func (cosigner *LocalCosigner) checkPartySet(partyIDs []byte, requester byte) error {
+	shares := cosigner.kgOutput.Shares
+	if want := int(shares.Threshold()) + 1; len(partyIDs) != want {
+		return &PartySetError{PartyIDs: partyIDs, Reason: fmt.Sprintf("has %d parties, signing takes %d", len(partyIDs), want)}
+	}
+	seen := make(map[byte]bool, len(partyIDs))
+	for _, id := range partyIDs {
+		if seen[id] {
+			return &PartySetError{PartyIDs: partyIDs, Reason: fmt.Sprintf("names cosigner %d twice", id)}
+		}
+		seen[id] = true
+		if !shares.PartySet.Contains(party.ID(id)) {
+			return &PartySetError{PartyIDs: partyIDs, Reason: fmt.Sprintf("names cosigner %d without a key share", id)}
+		}
+	}
+	if !seen[byte(cosigner.kgOutput.Secret.ID)] {
+		return &PartySetError{PartyIDs: partyIDs, Reason: fmt.Sprintf("does not name us (cosigner %d)", cosigner.kgOutput.Secret.ID)}
+	}
+	if !seen[requester] {
+		return &PartySetError{PartyIDs: partyIDs, Reason: fmt.Sprintf("does not name the requester (cosigner %d)", requester)}
+	}
+	return nil
+}
+
+// pubKey returns the group key of the cosigners
+func (cosigner *LocalCosigner) pubKey() crypto.PubKey {
+	return tmcrypto.PubKey(cosigner.kgOutput.Shares.GroupKey().ToEd25519())
+}
+
+// ChainID returns the chain ID this cosigner signs for
+func (cosigner *LocalCosigner) ChainID() string {
+	return cosigner.chainId
+}
+
 func getPartySet(parties_arr []byte) (*party.Set, error) {
 	parties := make([]party.ID, len(parties_arr))
 	for i, pid := range parties_arr {
@@ -126,11 +361,19 @@ func getPartySet(parties_arr []byte) (*party.Set, error) {
 	return party.NewSet(parties)
 }
 
-func (cosigner *LocalCosigner) StartSession(req CosignerStartSessionRequest) (CosignerStartSessionResponse, error) {
+func (cosigner *LocalCosigner) StartSession(_ context.Context, req CosignerStartSessionRequest) (res CosignerStartSessionResponse, err error) {
 	cosigner.lastSignStateMutex.Lock()
 	defer cosigner.lastSignStateMutex.Unlock()
+	defer cosigner.observeSessions()
+	defer func() {
+		if auditErr := cosigner.recordDecision("start_session", req.ID, req.SignBytes, AuditAccepted, res.MaybeSig, err); auditErr != nil {
+			res, err = CosignerStartSessionResponse{}, auditErr
+		}
+	}()
+	if err := cosigner.checkAvailable(); err != nil {
+		return res, err
+	}
 
-	res := CosignerStartSessionResponse{}
 	lss := cosigner.lastSignState
 
 	height, round, step, chainId, err := UnpackHRS(req.SignBytes)
@@ -138,7 +381,10 @@ func (cosigner *LocalCosigner) StartSession(req CosignerStartSessionRequest) (Co
 		return res, err
 	}
 	if chainId != cosigner.chainId {
-		return res, errors.New("wrong chain ID")
+		return res, &ChainIDError{ChainID: chainId, Expected: cosigner.chainId}
+	}
+	if err := cosigner.checkPartySet(req.PartyIDs, req.ID); err != nil {
+		return res, err
 	}
 
 	sameHRS, err := lss.CheckHRS(height, round, step)
@@ -151,9 +397,9 @@ func (cosigner *LocalCosigner) StartSession(req CosignerStartSessionRequest) (Co
 	if sameHRS {
 		if bytes.Equal(req.SignBytes, lss.SignBytes) {
 			res.MaybeSig = lss.Signature
-			return res, errors.New("signed before")
+			return res, ErrSignedBefore
 		} else if _, ok := lss.OnlyDifferByTimestamp(req.SignBytes); !ok {
-			return res, errors.New("mismatched data")
+			return res, ErrDoubleSign
 		}
 
 		// same HRS, and only differ by timestamp - ok to sign again
@@ -163,57 +409,66 @@ func (cosigner *LocalCosigner) StartSession(req CosignerStartSessionRequest) (Co
 		Round:  round,
 		Step:   step,
 	}
-	// FIXME: verify party IDs length etc.
-	partyKey := getSortedPartyIds(req.PartyIDs)
-	msessions, ok := cosigner.sessions[hrsKey]
+	if err := cosigner.checkLookahead(req.ID, height); err != nil {
+		return res, err
+	}
+	partyKey := getSortedPartyIds(req.ID, req.PartyIDs)
+	msession, ok := cosigner.sessions.Get(hrsKey, partyKey)
+	inProgress := ok && msession.state != nil && !msession.state.IsFinished() && msession.expirationTime.Unix() > time.Now().Unix()
+	if !ok {
+		msession, ok = cosigner.sessions.Any(hrsKey)
+	}
+	// conflicting sign bytes are a double-sign attempt, even while a session is in progress
 	if ok {
-		msession, ok2 := msessions[partyKey]
-		if ok2 && !msession.state.IsFinished() && msession.expirationTime.Unix() > time.Now().Unix() {
-			return res, errors.New("already being signed on")
-		}
-		if !ok2 {
-			msession = *getSession(msessions)
-		}
 		if _, almostsame := CheckOnlyDifferByTimestamp(step, msession.currentSignBytes, req.SignBytes); !almostsame {
-			return res, errors.New("mismatched data")
+			return res, ErrDoubleSign
 		}
 	}
+	if inProgress {
+		return res, ErrSessionInProgress
+	}
 
 	partySet, err := getPartySet(req.PartyIDs)
 	if err != nil {
 		return res, err
 	}
 
-	state, output, err := frost.NewSignState(partySet, cosigner.kgOutput.Secret, cosigner.kgOutput.Shares, req.SignBytes, cosigner.timeout)
+	// the state gets no timer: it would finish the state on a goroutine of its own,
+	// racing with the handling of the messages. Sessions expire through the session store.
+	state, output, err := frost.NewSignState(partySet, cosigner.kgOutput.Secret, cosigner.kgOutput.Shares, req.SignBytes, 0)
 	if err != nil {
 		return res, err
 	}
-	if !ok {
-		msessions = make(map[SortedPartyIds]HRSMeta)
-	}
-	msessions[partyKey] = HRSMeta{
+	err = cosigner.sessions.Put(hrsKey, partyKey, HRSMeta{
 		state:            state,
 		output:           output,
 		currentSignBytes: req.SignBytes,
 		expirationTime:   time.Now().Add(cosigner.timeout),
+	}, cosigner.watermark())
+	if err != nil {
+		return res, err
 	}
-	cosigner.sessions[hrsKey] = msessions
 	msgs1, err := helpers.PartyRoutine(nil, state)
 	if err != nil {
-		delete(cosigner.sessions[hrsKey], partyKey)
-		if len(cosigner.sessions[hrsKey]) == 0 {
-			delete(cosigner.sessions, hrsKey)
-		}
-		return res, err
+		cosigner.sessions.Delete(hrsKey, partyKey)
+		return res, newProtocolError(err)
 	}
 	res.Msg1Out = msgs1
 	return res, nil
 }
 
-func (cosigner *LocalCosigner) EndSession(req CosignerEndSessionRequest) (CosignerEndSessionResponse, error) {
+func (cosigner *LocalCosigner) EndSession(_ context.Context, req CosignerEndSessionRequest) (res CosignerEndSessionResponse, err error) {
 	cosigner.lastSignStateMutex.Lock()
 	defer cosigner.lastSignStateMutex.Unlock()
-	res := CosignerEndSessionResponse{}
+	defer cosigner.observeSessions()
+	defer func() {
+		if auditErr := cosigner.recordDecision("end_session", req.ID, req.SignBytes, AuditSigned, res.MaybeSig, err); auditErr != nil {
+			res, err = CosignerEndSessionResponse{}, auditErr
+		}
+	}()
+	if err := cosigner.checkAvailable(); err != nil {
+		return res, err
+	}
 	lss := cosigner.lastSignState
 
 	height, round, step, chainId, err := UnpackHRS(req.SignBytes)
@@ -221,7 +476,10 @@ func (cosigner *LocalCosigner) EndSession(req CosignerEndSessionRequest) (Cosign
 		return res, err
 	}
 	if chainId != cosigner.chainId {
-		return res, errors.New("wrong chain ID")
+		return res, &ChainIDError{ChainID: chainId, Expected: cosigner.chainId}
+	}
+	if err := cosigner.checkPartySet(req.PartyIDs, req.ID); err != nil {
+		return res, err
 	}
 	sameHRS, err := lss.CheckHRS(height, round, step)
 	if err != nil {
@@ -233,9 +491,9 @@ func (cosigner *LocalCosigner) EndSession(req CosignerEndSessionRequest) (Cosign
 	if sameHRS {
 		if bytes.Equal(req.SignBytes, lss.SignBytes) {
 			res.MaybeSig = lss.Signature
-			return res, errors.New("signed before")
+			return res, ErrSignedBefore
 		} else if _, ok := lss.OnlyDifferByTimestamp(req.SignBytes); !ok {
-			return res, errors.New("mismatched data")
+			return res, ErrDoubleSign
 		}
 	}
 
@@ -244,85 +502,153 @@ func (cosigner *LocalCosigner) EndSession(req CosignerEndSessionRequest) (Cosign
 		Round:  round,
 		Step:   step,
 	}
-	sessions, ok := cosigner.sessions[hrsKey]
-	if !ok {
-		return res, errors.New("invalid session")
-	}
-	// FIXME: verify party IDs length etc.
-	partyKey := getSortedPartyIds(req.PartyIDs)
-	session, ok2 := sessions[partyKey]
-	if !ok2 {
-		return res, errors.New("invalid session")
+	partyKey := getSortedPartyIds(req.ID, req.PartyIDs)
+	session, ok := cosigner.sessions.Get(hrsKey, partyKey)
+	if !ok || session.state == nil {
+		return res, ErrInvalidSession
 	}
 
 	if !bytes.Equal(req.SignBytes, session.currentSignBytes) {
-		return res, errors.New("wrong signing payload")
+		return res, fmt.Errorf("%w: wrong signing payload", ErrDoubleSign)
 	}
 
 	msgs2, err := helpers.PartyRoutine(req.Msg1Out, session.state)
 	if err != nil {
-		delete(cosigner.sessions[hrsKey], partyKey)
-		if len(cosigner.sessions[hrsKey]) == 0 {
-			delete(cosigner.sessions, hrsKey)
-		}
-		return res, err
+		cosigner.sessions.Delete(hrsKey, partyKey)
+		return res, newProtocolError(err)
 	}
+	session.released = true
+	// replacing a session never fails
+	_ = cosigner.sessions.Put(hrsKey, partyKey, session, cosigner.watermark())
 	res.Msg2Out = msgs2
 	return res, nil
 }
 
-func (cosigner *LocalCosigner) FinalSign(hrsKey HRSKey, partyIds []byte, msg2out [][]byte) ([]byte, error) {
+func (cosigner *LocalCosigner) FinalSign(hrsKey HRSKey, partyIds []byte, msg2out [][]byte) (sig []byte, err error) {
 	cosigner.lastSignStateMutex.Lock()
 	defer cosigner.lastSignStateMutex.Unlock()
-	sessions, ok := cosigner.sessions[hrsKey]
-	if !ok {
-		return nil, errors.New("invalid session")
+	defer cosigner.observeSignState()
+	var signBytes []byte
+	defer func() {
+		if auditErr := cosigner.recordDecision("final_sign", byte(cosigner.kgOutput.Secret.ID), signBytes, AuditSigned, nil, err); auditErr != nil {
+			sig, err = nil, auditErr
+		}
+	}()
+	if err := cosigner.checkAvailable(); err != nil {
+		return nil, err
 	}
-	partyKey := getSortedPartyIds(partyIds)
-	session, ok2 := sessions[partyKey]
-	if !ok2 {
-		return nil, errors.New("invalid session")
+	partyKey := getSortedPartyIds(byte(cosigner.kgOutput.Secret.ID), partyIds)
+	session, ok := cosigner.sessions.Get(hrsKey, partyKey)
+	if !ok || session.state == nil {
+		return nil, ErrInvalidSession
 	}
+	signBytes = session.currentSignBytes
 
-	_, err := helpers.PartyRoutine(msg2out, session.state)
-	if err != nil {
-		delete(cosigner.sessions[hrsKey], partyKey)
-		if len(cosigner.sessions[hrsKey]) == 0 {
-			delete(cosigner.sessions, hrsKey)
+	// another coordinator may have set a signature for the HRS since the session started
+	lss := cosigner.lastSignState
+	if sameHRS, _ := lss.CheckHRS(hrsKey.Height, hrsKey.Round, hrsKey.Step); sameHRS {
+		if _, ok := lss.OnlyDifferByTimestamp(signBytes); !ok && !bytes.Equal(signBytes, lss.SignBytes) {
+			return nil, ErrDoubleSign
 		}
-		return nil, err
+	}
+
+	_, err = helpers.PartyRoutine(msg2out, session.state)
+	if err != nil {
+		cosigner.sessions.Delete(hrsKey, partyKey)
+		return nil, newProtocolError(err)
+	}
+	// without a timer, the state either finished with the messages just handled or never will
+	if !session.state.IsFinished() {
+		cosigner.sessions.Delete(hrsKey, partyKey)
+		return nil, newProtocolError(errors.New("messages of the session missing"))
 	}
 	if err = session.state.WaitForError(); err != nil {
-		delete(cosigner.sessions[hrsKey], partyKey)
-		if len(cosigner.sessions[hrsKey]) == 0 {
-			delete(cosigner.sessions, hrsKey)
-		}
-		return nil, err
+		cosigner.sessions.Delete(hrsKey, partyKey)
+		return nil, newProtocolError(err)
 	}
 
-	cosigner.lastSignState.Height = hrsKey.Height
-	cosigner.lastSignState.Round = hrsKey.Round
-	cosigner.lastSignState.Step = hrsKey.Step
-	cosigner.lastSignState.Signature = session.output.Signature.ToEd25519()
-	cosigner.lastSignState.SignBytes = session.currentSignBytes
-	cosigner.lastSignState.Save()
+	sig = session.output.Signature.ToEd25519()
+	cosigner.advanceWatermark(hrsKey, session.currentSignBytes, sig)
+	return sig, nil
+}
+
+// advanceWatermark records the signature in the sign state, unless the sign state is past its HRS
+// already because a session of a higher HRS finished first.
+// Sessions below the new watermark are dropped, except those that handed out our share already:
+// they can only produce the signature they were started for, so they may still finish.
+func (cosigner *LocalCosigner) advanceWatermark(hrsKey HRSKey, signBytes []byte, sig []byte) {
+	lss := cosigner.lastSignState
+	last := HRSKey{
+		Height: lss.Height,
+		Round:  lss.Round,
+		Step:   lss.Step,
+	}
+	if hrsKey.Less(last) {
+		return
+	}
+	lss.Height = hrsKey.Height
+	lss.Round = hrsKey.Round
+	lss.Step = hrsKey.Step
+	lss.Signature = sig
+	lss.SignBytes = signBytes
+	lss.Save()
+
+	// we will not be providing parts for any lower HRS
+	cosigner.sessions.DropBelow(hrsKey, time.Now())
+}
 
-	for existingKey := range cosigner.sessions {
-		// delete any HRS lower than our signed level
-		// we will not be providing parts for any lower HRS
-		if existingKey.Less(hrsKey) {
-			delete(cosigner.sessions, existingKey)
+// watermark returns the HRS of the last signature
+func (cosigner *LocalCosigner) watermark() HRSKey {
+	return HRSKey{
+		Height: cosigner.lastSignState.Height,
+		Round:  cosigner.lastSignState.Round,
+		Step:   cosigner.lastSignState.Step,
+	}
+}
+
+// checkLookahead refuses sessions of peers more than maxSessionLookahead heights above
+// the reference height: the highest of the last signed height and the heights our own nodes
+// requested. Our own requests raise the reference height, so that after an outage the
+// peers' sessions are accepted again as soon as our nodes catch up.
+// Dry-run cosigners sign for arbitrary heights and have no limit.
+func (cosigner *LocalCosigner) checkLookahead(partyID byte, height int64) error {
+	if party.ID(partyID) == cosigner.kgOutput.Secret.ID {
+		if height > cosigner.referenceHeight {
+			cosigner.referenceHeight = height
 		}
+		return nil
+	}
+	if cosigner.lastSignState.inMemory {
+		return nil
+	}
+	reference := cosigner.referenceHeight
+	if cosigner.lastSignState.Height > reference {
+		reference = cosigner.lastSignState.Height
 	}
+	if height > reference+maxSessionLookahead {
+		return &LookaheadError{Height: height, Reference: reference, Lookahead: maxSessionLookahead}
+	}
+	return nil
+}
 
-	return cosigner.lastSignState.Signature, nil
+// ReapSessions drops the expired sessions that are safe to drop, see SessionStore
+func (cosigner *LocalCosigner) ReapSessions() int {
+	cosigner.lastSignStateMutex.Lock()
+	defer cosigner.lastSignStateMutex.Unlock()
+	defer cosigner.observeSessions()
+	return cosigner.sessions.Reap(time.Now(), cosigner.watermark())
 }
 
-func (cosigner *LocalCosigner) SetSignature(req CosignerSetSignatureRequest) (CosignerSetSignatureResponse, error) {
+func (cosigner *LocalCosigner) SetSignature(_ context.Context, req CosignerSetSignatureRequest) (res CosignerSetSignatureResponse, err error) {
 	cosigner.lastSignStateMutex.Lock()
 	defer cosigner.lastSignStateMutex.Unlock()
+	defer cosigner.observeSignState()
+	defer func() {
+		if auditErr := cosigner.recordDecision("set_signature", req.ID, req.SignBytes, AuditSigned, nil, err); auditErr != nil {
+			res, err = CosignerSetSignatureResponse{}, auditErr
+		}
+	}()
 
-	res := CosignerSetSignatureResponse{}
 	lss := cosigner.lastSignState
 	res.ID = req.ID
 	height, round, step, chainId, err := UnpackHRS(req.SignBytes)
@@ -330,7 +656,7 @@ func (cosigner *LocalCosigner) SetSignature(req CosignerSetSignatureRequest) (Co
 		return res, err
 	}
 	if chainId != cosigner.chainId {
-		return res, errors.New("wrong chain ID")
+		return res, &ChainIDError{ChainID: chainId, Expected: cosigner.chainId}
 	}
 	sameHRS, err := lss.CheckHRS(height, round, step)
 	if err != nil {
@@ -339,33 +665,157 @@ func (cosigner *LocalCosigner) SetSignature(req CosignerSetSignatureRequest) (Co
 
 	if sameHRS {
 		if bytes.Equal(req.SignBytes, lss.SignBytes) {
-			return res, errors.New("signed before")
+			return res, ErrSignedBefore
 		} else {
-			return res, errors.New("mismatched data")
+			return res, ErrDoubleSign
 		}
 	}
-	// FIXME: check signature
-	if len(req.Sig) != 64 {
-		return res, errors.New("incorrect signature")
+	if !cosigner.pubKey().VerifySignature(req.SignBytes, req.Sig) {
+		return res, ErrInvalidSignature
 	}
 
-	cosigner.lastSignState.Height = height
-	cosigner.lastSignState.Round = round
-	cosigner.lastSignState.Step = step
-	cosigner.lastSignState.Signature = req.Sig
-	cosigner.lastSignState.SignBytes = req.SignBytes
-	cosigner.lastSignState.Save()
 	hrsKey := HRSKey{
 		Height: height,
 		Round:  round,
 		Step:   step,
 	}
-	for existingKey := range cosigner.sessions {
-		// delete any HRS lower than our signed level
-		// we will not be providing parts for any lower HRS
-		if existingKey.Less(hrsKey) {
-			delete(cosigner.sessions, existingKey)
+	cosigner.advanceWatermark(hrsKey, req.SignBytes, req.Sig)
+	return res, nil
+}
+
+// Commitments hands out commitments to n new nonce pairs to the coordinator for preprocessed signing
+func (cosigner *LocalCosigner) Commitments(coordinator byte, n int) ([]NonceCommitment, error) {
+	cosigner.lastSignStateMutex.Lock()
+	defer cosigner.lastSignStateMutex.Unlock()
+	if n < 1 || n > maxCommitmentsPerRequest {
+		return nil, fmt.Errorf("cannot hand out %d commitments, at most %d", n, maxCommitmentsPerRequest)
+	}
+	if cosigner.nonces == nil {
+		nonces, err := newNoncePool()
+		if err != nil {
+			return nil, err
+		}
+		cosigner.nonces = nonces
+	}
+	return cosigner.nonces.commit(byte(cosigner.kgOutput.Secret.ID), coordinator, n)
+}
+
+// SignPreprocessed returns our signature share of the sign bytes over the commitments of the parties.
+// The request goes through the same checks as StartSession, and the nonce of our commitment
+// is used up whether or not the share is returned.
+func (cosigner *LocalCosigner) SignPreprocessed(_ context.Context, req CosignerSignRequest) (res CosignerSignResponse, err error) {
+	cosigner.lastSignStateMutex.Lock()
+	defer cosigner.lastSignStateMutex.Unlock()
+	defer cosigner.observeSessions()
+	defer func() {
+		if auditErr := cosigner.recordDecision("sign", req.ID, req.SignBytes, AuditSigned, res.MaybeSig, err); auditErr != nil {
+			res, err = CosignerSignResponse{}, auditErr
 		}
+	}()
+	if err := cosigner.checkAvailable(); err != nil {
+		return res, err
 	}
+	lss := cosigner.lastSignState
+
+	height, round, step, chainId, err := UnpackHRS(req.SignBytes)
+	if err != nil {
+		return res, err
+	}
+	if chainId != cosigner.chainId {
+		return res, &ChainIDError{ChainID: chainId, Expected: cosigner.chainId}
+	}
+	sameHRS, err := lss.CheckHRS(height, round, step)
+	if err != nil {
+		return res, err
+	}
+	if sameHRS {
+		if bytes.Equal(req.SignBytes, lss.SignBytes) {
+			res.MaybeSig = lss.Signature
+			return res, ErrSignedBefore
+		} else if _, ok := lss.OnlyDifferByTimestamp(req.SignBytes); !ok {
+			return res, ErrDoubleSign
+		}
+	}
+	hrsKey := HRSKey{
+		Height: height,
+		Round:  round,
+		Step:   step,
+	}
+	if err := cosigner.checkLookahead(req.ID, height); err != nil {
+		return res, err
+	}
+	if session, ok := cosigner.sessions.Any(hrsKey); ok {
+		if _, almostsame := CheckOnlyDifferByTimestamp(step, session.currentSignBytes, req.SignBytes); !almostsame {
+			return res, ErrDoubleSign
+		}
+	}
+
+	commitments := make([]NonceCommitment, 0, len(req.Commitments))
+	partyIDs := make([]byte, 0, len(req.Commitments))
+	var own *NonceCommitment
+	for _, data := range req.Commitments {
+		commitment, err := NonceCommitmentFromBytes(data)
+		if err != nil {
+			return res, &ProtocolError{Err: err}
+		}
+		commitments = append(commitments, commitment)
+		partyIDs = append(partyIDs, commitment.ID)
+		if party.ID(commitment.ID) == cosigner.kgOutput.Secret.ID {
+			own = &commitments[len(commitments)-1]
+		}
+	}
+	if err := cosigner.checkPartySet(partyIDs, req.ID); err != nil {
+		return res, err
+	}
+	// the session holds on to the sign bytes, so that no other payload is signed for the HRS
+	partyKey := getSortedPartyIds(req.ID, partyIDs)
+	if _, exists := cosigner.sessions.Get(hrsKey, partyKey); !exists {
+		err = cosigner.sessions.Put(hrsKey, partyKey, HRSMeta{
+			currentSignBytes: req.SignBytes,
+			expirationTime:   time.Now().Add(cosigner.timeout),
+			released:         true,
+		}, cosigner.watermark())
+		if err != nil {
+			return res, err
+		}
+	}
+	if cosigner.nonces == nil {
+		return res, ErrUnknownCommitment
+	}
+	// the nonce is gone from now on, even if signing fails below
+	nonce, err := cosigner.nonces.take(*own, req.ID)
+	if err != nil {
+		return res, err
+	}
+	preprocessed, err := newPreprocessedRound(cosigner.kgOutput.Shares, req.SignBytes, commitments)
+	if err != nil {
+		return res, &ProtocolError{Err: err}
+	}
+	z, err := preprocessed.share(cosigner.kgOutput.Secret, nonce)
+	if err != nil {
+		return res, &ProtocolError{Err: err}
+	}
+	res.Share = z.Bytes()
 	return res, nil
 }
+
+// RecordSignature records the signature produced by preprocessed signing in the sign state,
+// rechecking it against the sign state as FinalSign does
+func (cosigner *LocalCosigner) RecordSignature(hrsKey HRSKey, signBytes []byte, sig []byte) (err error) {
+	cosigner.lastSignStateMutex.Lock()
+	defer cosigner.lastSignStateMutex.Unlock()
+	defer cosigner.observeSignState()
+	defer func() {
+		if auditErr := cosigner.recordDecision("final_sign", byte(cosigner.kgOutput.Secret.ID), signBytes, AuditSigned, nil, err); auditErr != nil {
+			err = auditErr
+		}
+	}()
+	lss := cosigner.lastSignState
+	if sameHRS, _ := lss.CheckHRS(hrsKey.Height, hrsKey.Round, hrsKey.Step); sameHRS {
+		if _, ok := lss.OnlyDifferByTimestamp(signBytes); !ok && !bytes.Equal(signBytes, lss.SignBytes) {
+			return ErrDoubleSign
+		}
+	}
+	cosigner.advanceWatermark(hrsKey, signBytes, sig)
+	return nil
+}
@@ -0,0 +1,209 @@
+package signer
+
+import (
+	"context"
+	"crypto/sha256"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"filippo.io/edwards25519"
+	"github.com/taurusgroup/frost-ed25519/pkg/eddsa"
+	"github.com/taurusgroup/frost-ed25519/pkg/frost"
+	"github.com/taurusgroup/frost-ed25519/pkg/frost/keygen"
+	"github.com/taurusgroup/frost-ed25519/pkg/frost/party"
+	"github.com/taurusgroup/frost-ed25519/pkg/helpers"
+	"github.com/taurusgroup/frost-ed25519/pkg/state"
+	tmProto "github.com/tendermint/tendermint/proto/tendermint/types"
+	tm "github.com/tendermint/tendermint/types"
+)
+
+const testChainID = "test-chain"
+
+// newTestCosigners runs the key generation for n cosigners in process and returns
+// their cosigners with in-memory sign states, indexed by cosigner ID - 1
+func newTestCosigners(t *testing.T, n int, threshold int) []*LocalCosigner {
+	t.Helper()
+	partySet := helpers.GenerateSet(party.Size(n))
+	states := make([]*state.State, n)
+	outputs := make([]*keygen.Output, n)
+	for i := range states {
+		var err error
+		states[i], outputs[i], err = frost.NewKeygenState(party.ID(i+1), partySet, party.Size(threshold), 0)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	// every round takes the messages of all parties in the previous round
+	var msgs [][]byte
+	for round := 0; round < 3; round++ {
+		var next [][]byte
+		for _, s := range states {
+			out, err := helpers.PartyRoutine(msgs, s)
+			if err != nil {
+				t.Fatalf("keygen round %d: %v", round+1, err)
+			}
+			next = append(next, out...)
+		}
+		msgs = next
+	}
+
+	cosigners := make([]*LocalCosigner, n)
+	for i, s := range states {
+		if err := s.WaitForError(); err != nil {
+			t.Fatal(err)
+		}
+		signState := NewMemorySignState()
+		cosigners[i] = &LocalCosigner{
+			kgOutput:      KeyGenOutput{Secret: outputs[i].SecretKey, Shares: outputs[i].Public},
+			lastSignState: &signState,
+			sessions:      NewSessionStore(),
+			timeout:       time.Minute,
+			chainId:       testChainID,
+		}
+	}
+	return cosigners
+}
+
+// testVote returns the sign bytes of a prevote for the block at the height
+func testVote(height int64, block string, timestamp time.Time) []byte {
+	hash := sha256.Sum256([]byte(block))
+	parts := sha256.Sum256([]byte(block + "/parts"))
+	return tm.VoteSignBytes(testChainID, &tmProto.Vote{
+		Type:   tmProto.PrevoteType,
+		Height: height,
+		BlockID: tmProto.BlockID{
+			Hash:          hash[:],
+			PartSetHeader: tmProto.PartSetHeader{Total: 1, Hash: parts[:]},
+		},
+		Timestamp: timestamp,
+	})
+}
+
+func TestCheckPartySet(t *testing.T) {
+	// cosigner 1 of a 2-of-3 group; checking the party set takes no actual key material
+	shares := make(map[party.ID]*edwards25519.Point)
+	for id := party.ID(1); id <= 3; id++ {
+		shares[id] = edwards25519.NewGeneratorPoint()
+	}
+	cosigner := &LocalCosigner{kgOutput: KeyGenOutput{
+		Secret: &eddsa.SecretShare{ID: 1},
+		Shares: eddsa.NewPublic(shares, 1, edwards25519.NewGeneratorPoint()),
+	}}
+
+	cases := []struct {
+		name      string
+		partyIDs  []byte
+		requester byte
+		reason    string
+	}{
+		{"requested by a peer", []byte{1, 2}, 2, ""},
+		{"requested by us", []byte{3, 1}, 1, ""},
+		{"empty", nil, 2, "has 0 parties"},
+		{"too few parties", []byte{1}, 1, "has 1 parties"},
+		{"too many parties", []byte{1, 2, 3}, 2, "has 3 parties"},
+		{"duplicate", []byte{1, 1}, 1, "names cosigner 1 twice"},
+		{"unknown cosigner", []byte{1, 4}, 4, "names cosigner 4 without a key share"},
+		{"without us", []byte{2, 3}, 2, "does not name us"},
+		{"without the requester", []byte{1, 3}, 2, "does not name the requester"},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			err := cosigner.checkPartySet(c.partyIDs, c.requester)
+			if c.reason == "" {
+				if err != nil {
+					t.Fatalf("got error %v", err)
+				}
+				return
+			}
+			var partySetErr *PartySetError
+			if !errors.As(err, &partySetErr) || !errors.Is(err, ErrInvalidPartySet) {
+				t.Fatalf("got error %v, want a PartySetError", err)
+			}
+			if !strings.Contains(partySetErr.Reason, c.reason) {
+				t.Errorf("got reason %q, want %q", partySetErr.Reason, c.reason)
+			}
+		})
+	}
+}
+
+func TestGetSortedPartyIds(t *testing.T) {
+	partyIDs := []byte{3, 1, 2}
+	key := getSortedPartyIds(1, partyIDs)
+	if string(partyIDs) != string([]byte{3, 1, 2}) {
+		t.Errorf("party IDs of the caller changed to %v", partyIDs)
+	}
+	if other := getSortedPartyIds(1, []byte{2, 3, 1}); other != key {
+		t.Errorf("got key %v for the same parties in another order, want %v", other, key)
+	}
+	if other := getSortedPartyIds(2, partyIDs); other == key {
+		t.Errorf("got key %v for another coordinator", other)
+	}
+}
+
+func TestStartSessionKeepsReleasedSession(t *testing.T) {
+	cosigners := newTestCosigners(t, 3, 1)
+	local, coordinator := cosigners[0], cosigners[1]
+	ctx := context.Background()
+	now := time.Now()
+
+	// our share is released for the sign bytes, then the session expires
+	local.SetTimeout(-time.Minute)
+	start := CosignerStartSessionRequest{ID: 2, PartyIDs: []byte{1, 2}, SignBytes: testVote(1, "a", now)}
+	ours, err := local.StartSession(ctx, start)
+	if err != nil {
+		t.Fatal(err)
+	}
+	theirs, err := coordinator.StartSession(ctx, start)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = local.EndSession(ctx, CosignerEndSessionRequest{
+		ID:        start.ID,
+		PartyIDs:  start.PartyIDs,
+		SignBytes: start.SignBytes,
+		Msg1Out:   append(ours.Msg1Out, theirs.Msg1Out...),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the coordinator restarts the round with another timestamp, which expires as well
+	start.SignBytes = testVote(1, "a", now.Add(time.Second))
+	if _, err := local.StartSession(ctx, start); err != nil {
+		t.Fatal(err)
+	}
+	local.ReapSessions()
+
+	conflicting := CosignerStartSessionRequest{ID: 3, PartyIDs: []byte{1, 3}, SignBytes: testVote(1, "b", now)}
+	if _, err := local.StartSession(ctx, conflicting); !errors.Is(err, ErrDoubleSign) {
+		t.Errorf("got error %v for conflicting sign bytes, want %v", err, ErrDoubleSign)
+	}
+}
+
+func TestStartSessionInProgress(t *testing.T) {
+	now := time.Now()
+	start := CosignerStartSessionRequest{ID: 2, PartyIDs: []byte{1, 2}, SignBytes: testVote(1, "a", now)}
+	for _, tc := range []struct {
+		name    string
+		request CosignerStartSessionRequest
+		want    error
+	}{
+		{"same sign bytes", start, ErrSessionInProgress},
+		{"other timestamp", CosignerStartSessionRequest{ID: 2, PartyIDs: []byte{1, 2}, SignBytes: testVote(1, "a", now.Add(time.Second))}, ErrSessionInProgress},
+		{"conflicting", CosignerStartSessionRequest{ID: 2, PartyIDs: []byte{1, 2}, SignBytes: testVote(1, "b", now)}, ErrDoubleSign},
+		{"conflicting, other parties", CosignerStartSessionRequest{ID: 3, PartyIDs: []byte{1, 3}, SignBytes: testVote(1, "b", now)}, ErrDoubleSign},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			local := newTestCosigners(t, 3, 1)[0]
+			ctx := context.Background()
+			if _, err := local.StartSession(ctx, start); err != nil {
+				t.Fatal(err)
+			}
+			if _, err := local.StartSession(ctx, tc.request); !errors.Is(err, tc.want) {
+				t.Errorf("got error %v, want %v", err, tc.want)
+			}
+		})
+	}
+}
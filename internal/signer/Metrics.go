@@ -0,0 +1,112 @@
+package signer
+
+import (
+	"net/http"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+const metricsNamespace = "tmkms"
+
+var (
+	metricSignDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: metricsNamespace,
+		Name:      "sign_duration_seconds",
+		Help:      "Time taken to produce a threshold signature for a Tendermint request.",
+		Buckets:   []float64{0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10},
+	}, []string{"chain_id", "step"})
+
+	metricSignRequests = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: metricsNamespace,
+		Name:      "sign_requests_total",
+		Help:      "Number of Tendermint sign requests by result, error class and error reason.",
+	}, []string{"chain_id", "step", "result", "class", "reason"})
+
+	metricSignCoalesced = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: metricsNamespace,
+		Name:      "sign_requests_coalesced_total",
+		Help:      "Number of Tendermint sign requests that joined an identical signing round in progress instead of starting their own.",
+	}, []string{"chain_id", "step"})
+
+	metricLastSignedHeight = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: metricsNamespace,
+		Name:      "last_signed_height",
+		Help:      "Height of the last signature recorded in the sign state.",
+	}, []string{"chain_id"})
+
+	metricLastSignedRound = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: metricsNamespace,
+		Name:      "last_signed_round",
+		Help:      "Round of the last signature recorded in the sign state.",
+	}, []string{"chain_id"})
+
+	metricLastSignedStep = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: metricsNamespace,
+		Name:      "last_signed_step",
+		Help:      "Step of the last signature recorded in the sign state (1 propose, 2 prevote, 3 precommit).",
+	}, []string{"chain_id"})
+
+	metricPeerReplyDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: metricsNamespace,
+		Name:      "cosigner_reply_duration_seconds",
+		Help:      "Time taken by a remote cosigner to reply to a request.",
+		Buckets:   []float64{0.001, 0.0025, 0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5},
+	}, []string{"peer", "request"})
+
+	metricPeerTimeouts = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: metricsNamespace,
+		Name:      "cosigner_timeouts_total",
+		Help:      "Number of requests a remote cosigner did not reply to in time.",
+	}, []string{"peer", "request"})
+
+	metricPeerMisbehavior = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: metricsNamespace,
+		Name:      "cosigner_misbehavior_total",
+		Help:      "Number of signing rounds that failed because of an invalid message of a remote cosigner.",
+	}, []string{"peer", "request"})
+
+	metricNodeConnected = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: metricsNamespace,
+		Name:      "node_connected",
+		Help:      "Whether the connection to a Tendermint node is established (1) or not (0).",
+	}, []string{"chain_id", "node"})
+
+	metricNodeConnectionEvents = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: metricsNamespace,
+		Name:      "node_connection_events_total",
+		Help:      "Number of connection events with a Tendermint node: connected, dial_failed, handshake_failed, idle_timeout, read_error, write_error or closed.",
+	}, []string{"chain_id", "node", "event"})
+
+	metricLocalSessions = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: metricsNamespace,
+		Name:      "local_sessions",
+		Help:      "Number of signing sessions held by the local cosigner.",
+	}, []string{"chain_id"})
+
+	metricFaultsInjected = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: metricsNamespace,
+		Name:      "faults_injected_total",
+		Help:      "Number of faults injected in chaos mode into the requests to a peer cosigner or from a node.",
+	}, []string{"target", "fault"})
+)
+
+// RegisterMetrics adds the /metrics endpoint to the mux
+func RegisterMetrics(mux *http.ServeMux) {
+	mux.Handle("/metrics", promhttp.Handler())
+}
+
+// stepLabel returns the metric label for a consensus step
+func stepLabel(step int8) string {
+	switch step {
+	case stepPropose:
+		return "propose"
+	case stepPrevote:
+		return "prevote"
+	case stepPrecommit:
+		return "precommit"
+	default:
+		return "none"
+	}
+}
@@ -0,0 +1,71 @@
+package signer
+
+import (
+	"fmt"
+	"time"
+)
+
+// NodeConnectionConfig tunes the connections to the nodes, so that a connection to a node
+// that went away without closing it is noticed and dialed again
+type NodeConnectionConfig struct {
+	// timeout of dialing a node (default 30)
+	DialTimeoutSec int `toml:"dial_timeout_sec"`
+	// deadline of the handshake and of writing each reply (default 5)
+	WriteTimeoutSec int `toml:"write_timeout_sec"`
+	// a connection on which the node sent no request for this long is closed and dialed again;
+	// nodes ping their signer every few seconds when idle (default 30)
+	IdleTimeoutSec int `toml:"idle_timeout_sec"`
+	// period of the TCP keepalive probes (default 15, negative to disable them)
+	KeepAliveSec int `toml:"keepalive_sec"`
+}
+
+const (
+	defaultDialTimeout  = 30 * time.Second
+	defaultWriteTimeout = 5 * time.Second
+	defaultIdleTimeout  = 30 * time.Second
+	defaultKeepAlive    = 15 * time.Second
+)
+
+func (cfg NodeConnectionConfig) dialTimeout() time.Duration {
+	return secondsOr(cfg.DialTimeoutSec, defaultDialTimeout)
+}
+
+func (cfg NodeConnectionConfig) writeTimeout() time.Duration {
+	return secondsOr(cfg.WriteTimeoutSec, defaultWriteTimeout)
+}
+
+func (cfg NodeConnectionConfig) idleTimeout() time.Duration {
+	return secondsOr(cfg.IdleTimeoutSec, defaultIdleTimeout)
+}
+
+// keepAlive returns the keepalive period of the dialer, negative if keepalive is disabled
+func (cfg NodeConnectionConfig) keepAlive() time.Duration {
+	return secondsOr(cfg.KeepAliveSec, defaultKeepAlive)
+}
+
+// secondsOr returns the seconds as a duration, or the default if they are 0
+func secondsOr(seconds int, def time.Duration) time.Duration {
+	if seconds == 0 {
+		return def
+	}
+	return time.Duration(seconds) * time.Second
+}
+
+// validate returns the problems of the node connection config
+func (cfg NodeConnectionConfig) validate() []string {
+	var problems []string
+	timeouts := []struct {
+		name  string
+		value int
+	}{
+		{"dial_timeout_sec", cfg.DialTimeoutSec},
+		{"write_timeout_sec", cfg.WriteTimeoutSec},
+		{"idle_timeout_sec", cfg.IdleTimeoutSec},
+	}
+	for _, timeout := range timeouts {
+		if timeout.value < 0 {
+			problems = append(problems, fmt.Sprintf("node_connection.%s: must not be negative, got %d", timeout.name, timeout.value))
+		}
+	}
+	return problems
+}
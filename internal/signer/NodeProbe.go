@@ -0,0 +1,53 @@
+package signer
+
+import (
+	"net"
+	"time"
+
+	tmCryptoEd2219 "github.com/tendermint/tendermint/crypto/ed25519"
+	tmNet "github.com/tendermint/tendermint/libs/net"
+	tmP2pConn "github.com/tendermint/tendermint/p2p/conn"
+)
+
+// NodeProbe is the outcome of probing a node's privval listener
+type NodeProbe struct {
+	// the node accepted the TCP connection
+	Reachable bool
+	// time to establish the TCP connection
+	RTT time.Duration
+	// the node completed the privval SecretConnection handshake
+	Handshake bool
+	Err       error
+}
+
+// ProbeNode dials the privval listener of a node and tries the SecretConnection handshake.
+//
+// A node only accepts a handshake while it waits for a signer, so a node already served by
+// a signer is reachable but lets the handshake time out. The connection is closed
+// right after the handshake, without answering any request of the node.
+func ProbeNode(address string, timeout time.Duration) NodeProbe {
+	var probe NodeProbe
+	proto, addr := tmNet.ProtocolAndAddress(address)
+	start := time.Now()
+	conn, err := net.DialTimeout(proto, addr, timeout)
+	if err != nil {
+		probe.Err = err
+		return probe
+	}
+	defer conn.Close()
+	probe.Reachable = true
+	probe.RTT = time.Since(start)
+
+	if err := conn.SetDeadline(time.Now().Add(timeout)); err != nil {
+		probe.Err = err
+		return probe
+	}
+	secretConn, err := tmP2pConn.MakeSecretConnection(conn, tmCryptoEd2219.GenPrivKey())
+	if err != nil {
+		probe.Err = err
+		return probe
+	}
+	defer secretConn.Close()
+	probe.Handshake = true
+	return probe
+}
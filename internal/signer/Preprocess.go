@@ -0,0 +1,359 @@
+package signer
+
+import (
+	"crypto/rand"
+	"crypto/sha512"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"sync"
+
+	"filippo.io/edwards25519"
+	"github.com/taurusgroup/frost-ed25519/pkg/eddsa"
+	"github.com/taurusgroup/frost-ed25519/pkg/frost/party"
+)
+
+// Preprocessed FROST signing.
+//
+// Each cosigner hands out commitments (D, E) = ([d]B, [e]B) to nonces (d, e) ahead of time.
+// A coordinator holding a commitment of each party of a session sends them together with the
+// sign bytes, and every party answers with its signature share straight away:
+//
+//	z_i = d_i + e_i ρ_i + λ_i s_i c
+//
+// so that signing needs a single round trip. The computation is the one of the two-round
+// protocol of the FROST library, so the shares and the signature are the same.
+//
+// A nonce must never sign two messages. Nonces are only kept in memory, tagged with an epoch
+// chosen at random when the cosigner starts, so no commitment handed out before a restart is
+// ever accepted after it, and a nonce is deleted before the share it signs is computed.
+
+const (
+	// size of the epoch tagging the commitments of a cosigner process
+	nonceEpochSize = 16
+	// size of an encoded NonceCommitment: party ID, epoch, index, D and E
+	nonceCommitmentSize = 1 + nonceEpochSize + 8 + 32 + 32
+	// most commitments a cosigner holds nonces for on behalf of one coordinator;
+	// the oldest of the coordinator are dropped beyond it
+	maxNoncesPerCoordinator = 256
+	// most commitments handed out in one request
+	maxCommitmentsPerRequest = 64
+)
+
+var hashDomainSeparation = []byte("FROST-SHA512")
+
+// NonceCommitment is the commitment of a party to a pair of nonces
+type NonceCommitment struct {
+	ID    byte
+	Epoch [nonceEpochSize]byte
+	Index uint64
+	D, E  edwards25519.Point
+}
+
+// Bytes encodes the commitment
+func (nc *NonceCommitment) Bytes() []byte {
+	out := make([]byte, 0, nonceCommitmentSize)
+	out = append(out, nc.ID)
+	out = append(out, nc.Epoch[:]...)
+	out = append(out, make([]byte, 8)...)
+	binary.BigEndian.PutUint64(out[1+nonceEpochSize:], nc.Index)
+	out = append(out, nc.D.Bytes()...)
+	out = append(out, nc.E.Bytes()...)
+	return out
+}
+
+// NonceCommitmentFromBytes decodes a commitment encoded by Bytes
+func NonceCommitmentFromBytes(data []byte) (NonceCommitment, error) {
+	var nc NonceCommitment
+	if len(data) != nonceCommitmentSize {
+		return nc, fmt.Errorf("invalid commitment length %d", len(data))
+	}
+	nc.ID = data[0]
+	copy(nc.Epoch[:], data[1:1+nonceEpochSize])
+	offset := 1 + nonceEpochSize
+	nc.Index = binary.BigEndian.Uint64(data[offset:])
+	offset += 8
+	if _, err := nc.D.SetBytes(data[offset : offset+32]); err != nil {
+		return nc, fmt.Errorf("invalid commitment D: %w", err)
+	}
+	if _, err := nc.E.SetBytes(data[offset+32 : offset+64]); err != nil {
+		return nc, fmt.Errorf("invalid commitment E: %w", err)
+	}
+	identity := edwards25519.NewIdentityPoint()
+	if nc.D.Equal(identity) == 1 || nc.E.Equal(identity) == 1 {
+		return nc, errors.New("commitment D or E is the identity")
+	}
+	return nc, nil
+}
+
+type nonce struct {
+	d, e edwards25519.Scalar
+	// the coordinator the commitment was handed out to, the only one that may use it
+	coordinator byte
+}
+
+// noncePool holds the nonces of the commitments a cosigner handed out.
+// Each coordinator has nonces for at most its last maxNoncesPerCoordinator commitments,
+// so that one coordinator cannot make the commitments of the others be dropped.
+// It is not safe for concurrent use.
+type noncePool struct {
+	epoch  [nonceEpochSize]byte
+	next   uint64
+	nonces map[uint64]*nonce
+	// indexes of the commitments handed out to each coordinator, oldest first
+	handedOut map[byte][]uint64
+}
+
+func newNoncePool() (*noncePool, error) {
+	pool := &noncePool{
+		nonces:    make(map[uint64]*nonce),
+		handedOut: make(map[byte][]uint64),
+	}
+	if _, err := rand.Read(pool.epoch[:]); err != nil {
+		return nil, err
+	}
+	return pool, nil
+}
+
+// commit samples n nonce pairs for the coordinator and returns their commitments
+func (pool *noncePool) commit(id byte, coordinator byte, n int) ([]NonceCommitment, error) {
+	commitments := make([]NonceCommitment, 0, n)
+	for i := 0; i < n; i++ {
+		nc := nonce{coordinator: coordinator}
+		if err := randomScalar(&nc.d); err != nil {
+			return nil, err
+		}
+		if err := randomScalar(&nc.e); err != nil {
+			return nil, err
+		}
+		commitment := NonceCommitment{ID: id, Epoch: pool.epoch, Index: pool.next}
+		commitment.D.ScalarBaseMult(&nc.d)
+		commitment.E.ScalarBaseMult(&nc.e)
+		pool.nonces[pool.next] = &nc
+		handedOut := append(pool.handedOut[coordinator], pool.next)
+		if len(handedOut) > maxNoncesPerCoordinator {
+			// drop the oldest nonce of the coordinator; its commitment will be refused
+			delete(pool.nonces, handedOut[0])
+			handedOut = handedOut[1:]
+		}
+		pool.handedOut[coordinator] = handedOut
+		pool.next++
+		commitments = append(commitments, commitment)
+	}
+	return commitments, nil
+}
+
+// take removes the nonce of the commitment handed out to the coordinator from the pool and returns it
+func (pool *noncePool) take(commitment NonceCommitment, coordinator byte) (*nonce, error) {
+	if commitment.Epoch != pool.epoch {
+		return nil, ErrUnknownCommitment
+	}
+	nc, ok := pool.nonces[commitment.Index]
+	if !ok || nc.coordinator != coordinator {
+		return nil, ErrUnknownCommitment
+	}
+	delete(pool.nonces, commitment.Index)
+	return nc, nil
+}
+
+func randomScalar(s *edwards25519.Scalar) error {
+	var buf [64]byte
+	if _, err := rand.Read(buf[:]); err != nil {
+		return err
+	}
+	s.SetUniformBytes(buf[:])
+	return nil
+}
+
+// preprocessedRound holds the values shared by all the parties of a session over preprocessed commitments
+type preprocessedRound struct {
+	partySet    *party.Set
+	commitments map[party.ID]NonceCommitment
+	// binding factors ρ_i
+	rho map[party.ID]*edwards25519.Scalar
+	// nonce shares R_i = D_i + [ρ_i] E_i and R = ∑ R_i
+	ri map[party.ID]*edwards25519.Point
+	R  edwards25519.Point
+	// challenge c = H(R, GroupKey, message)
+	c *edwards25519.Scalar
+}
+
+// newPreprocessedRound computes the binding factors, nonce and challenge of a session
+// given one commitment of each of its parties
+func newPreprocessedRound(shares *eddsa.Public, message []byte, commitments []NonceCommitment) (*preprocessedRound, error) {
+	ids := make([]party.ID, 0, len(commitments))
+	byID := make(map[party.ID]NonceCommitment, len(commitments))
+	for _, commitment := range commitments {
+		id := party.ID(commitment.ID)
+		if _, dup := byID[id]; dup {
+			return nil, fmt.Errorf("two commitments of party %d", id)
+		}
+		byID[id] = commitment
+		ids = append(ids, id)
+	}
+	partySet, err := party.NewSet(ids)
+	if err != nil {
+		return nil, err
+	}
+	if !partySet.IsSubsetOf(shares.PartySet) {
+		return nil, errors.New("not all parties of the commitments are in the key shares")
+	}
+	round := &preprocessedRound{
+		partySet:    partySet,
+		commitments: byID,
+		rho:         make(map[party.ID]*edwards25519.Scalar, len(ids)),
+		ri:          make(map[party.ID]*edwards25519.Point, len(ids)),
+	}
+
+	// ρ_i = SHA-512("FROST-SHA512" || i || SHA-512(message) || B)
+	// with B = (1 || D_1 || E_1) || ... || (n || D_n || E_n) in sorted order
+	messageHash := sha512.Sum512(message)
+	buffer := make([]byte, 0, len(hashDomainSeparation)+party.ByteSize+len(messageHash)+len(ids)*(party.ByteSize+64))
+	buffer = append(buffer, hashDomainSeparation...)
+	offsetID := len(buffer)
+	buffer = append(buffer, make([]byte, party.ByteSize)...)
+	buffer = append(buffer, messageHash[:]...)
+	sorted := partySet.Sorted()
+	for _, id := range sorted {
+		commitment := byID[id]
+		buffer = append(buffer, id.Bytes()...)
+		buffer = append(buffer, commitment.D.Bytes()...)
+		buffer = append(buffer, commitment.E.Bytes()...)
+	}
+
+	round.R.Set(edwards25519.NewIdentityPoint())
+	for _, id := range sorted {
+		copy(buffer[offsetID:], id.Bytes())
+		digest := sha512.Sum512(buffer)
+		rho := edwards25519.NewScalar().SetUniformBytes(digest[:])
+		round.rho[id] = rho
+
+		commitment := byID[id]
+		var ri edwards25519.Point
+		ri.ScalarMult(rho, &commitment.E)
+		ri.Add(&ri, &commitment.D)
+		round.ri[id] = &ri
+		round.R.Add(&round.R, &ri)
+	}
+	round.c = eddsa.ComputeChallenge(&round.R, shares.GroupKey(), message)
+	return round, nil
+}
+
+// share computes the signature share z_i = d_i + e_i ρ_i + λ_i s_i c of the owner of the secret
+func (round *preprocessedRound) share(secret *eddsa.SecretShare, nc *nonce) (*edwards25519.Scalar, error) {
+	lagrange, err := round.partySet.Lagrange(secret.ID)
+	if err != nil {
+		return nil, err
+	}
+	rho, ok := round.rho[secret.ID]
+	if !ok {
+		return nil, errors.New("no commitment of this cosigner")
+	}
+	var z, secretKeyShare edwards25519.Scalar
+	secretKeyShare.Multiply(lagrange, secret.Scalar())
+	z.Multiply(&secretKeyShare, round.c)
+	z.MultiplyAdd(&nc.e, rho, &z)
+	z.Add(&z, &nc.d)
+	return &z, nil
+}
+
+// verifyShare checks the signature share of a party
+func (round *preprocessedRound) verifyShare(shares *eddsa.Public, id party.ID, z *edwards25519.Scalar) error {
+	public, err := shares.ShareNormalized(id, round.partySet)
+	if err != nil {
+		return err
+	}
+	if !eddsa.Verify(round.c, z, public, round.ri[id]) {
+		return &ProtocolError{Culprit: byte(id), Err: errors.New("invalid signature share")}
+	}
+	return nil
+}
+
+// aggregate sums the signature shares of all the parties into the group signature and verifies it
+func (round *preprocessedRound) aggregate(shares *eddsa.Public, message []byte, zs map[party.ID]*edwards25519.Scalar) (*eddsa.Signature, error) {
+	var sig eddsa.Signature
+	sig.S.Set(edwards25519.NewScalar())
+	for id := range round.partySet.Range() {
+		z, ok := zs[id]
+		if !ok {
+			return nil, fmt.Errorf("missing signature share of cosigner %d", id)
+		}
+		if err := round.verifyShare(shares, id, z); err != nil {
+			return nil, err
+		}
+		sig.S.Add(&sig.S, z)
+	}
+	sig.R.Set(&round.R)
+	if !sig.Verify(message, shares.GroupKey()) {
+		return nil, ErrInvalidSignature
+	}
+	return &sig, nil
+}
+
+const (
+	// commitments of each peer the coordinator keeps at hand
+	commitmentPoolTarget = 32
+	// the pool of a peer is refilled when it holds fewer commitments
+	commitmentPoolLow = 8
+)
+
+// commitmentPool holds the commitments of the peers the coordinator has not used yet.
+// Each commitment is taken out of the pool once, so it is never sent in two requests.
+type commitmentPool struct {
+	mtx         sync.Mutex
+	commitments map[byte][]NonceCommitment
+	refilling   map[byte]bool
+}
+
+func newCommitmentPool() *commitmentPool {
+	return &commitmentPool{
+		commitments: make(map[byte][]NonceCommitment),
+		refilling:   make(map[byte]bool),
+	}
+}
+
+// take removes one commitment of each of the peers from the pool.
+// It takes none unless there is one for every peer.
+func (pool *commitmentPool) take(ids []byte) ([]NonceCommitment, bool) {
+	pool.mtx.Lock()
+	defer pool.mtx.Unlock()
+	for _, id := range ids {
+		if len(pool.commitments[id]) == 0 {
+			return nil, false
+		}
+	}
+	taken := make([]NonceCommitment, 0, len(ids)+1)
+	for _, id := range ids {
+		taken = append(taken, pool.commitments[id][0])
+		pool.commitments[id] = pool.commitments[id][1:]
+	}
+	return taken, true
+}
+
+// drop forgets the commitments of the peer, e.g. after it restarted and lost their nonces
+func (pool *commitmentPool) drop(id byte) {
+	pool.mtx.Lock()
+	defer pool.mtx.Unlock()
+	delete(pool.commitments, id)
+}
+
+// startRefill returns how many commitments of the peer to request,
+// or 0 if its pool is full enough or is being refilled already
+func (pool *commitmentPool) startRefill(id byte) int {
+	pool.mtx.Lock()
+	defer pool.mtx.Unlock()
+	n := len(pool.commitments[id])
+	if n >= commitmentPoolLow || pool.refilling[id] {
+		return 0
+	}
+	pool.refilling[id] = true
+	return commitmentPoolTarget - n
+}
+
+// endRefill adds the commitments received from the peer
+func (pool *commitmentPool) endRefill(id byte, commitments []NonceCommitment) {
+	pool.mtx.Lock()
+	defer pool.mtx.Unlock()
+	pool.commitments[id] = append(pool.commitments[id], commitments...)
+	delete(pool.refilling, id)
+}
@@ -0,0 +1,142 @@
+package signer
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"filippo.io/edwards25519"
+	"github.com/taurusgroup/frost-ed25519/pkg/eddsa"
+	"github.com/taurusgroup/frost-ed25519/pkg/frost/party"
+)
+
+// signPreprocessed has the cosigners of the party set sign the sign bytes over fresh commitments
+// handed out to the coordinator, and returns the request they answered
+func signPreprocessed(t *testing.T, cosigners []*LocalCosigner, coordinator byte, partyIDs []byte, signBytes []byte) (CosignerSignRequest, map[party.ID]*edwards25519.Scalar) {
+	t.Helper()
+	req := CosignerSignRequest{ID: coordinator, SignBytes: signBytes}
+	for _, id := range partyIDs {
+		commitments, err := cosigners[id-1].Commitments(coordinator, 1)
+		if err != nil {
+			t.Fatal(err)
+		}
+		req.Commitments = append(req.Commitments, commitments[0].Bytes())
+	}
+	shares := make(map[party.ID]*edwards25519.Scalar, len(partyIDs))
+	for _, id := range partyIDs {
+		res, err := cosigners[id-1].SignPreprocessed(context.Background(), req)
+		if err != nil {
+			t.Fatalf("cosigner %d: %v", id, err)
+		}
+		shares[party.ID(id)], err = edwards25519.NewScalar().SetCanonicalBytes(res.Share)
+		if err != nil {
+			t.Fatalf("cosigner %d: %v", id, err)
+		}
+	}
+	return req, shares
+}
+
+// aggregatePreprocessed sums the signature shares of the parties that answered the request
+func aggregatePreprocessed(t *testing.T, shares *eddsa.Public, req CosignerSignRequest, zs map[party.ID]*edwards25519.Scalar) (*eddsa.Signature, error) {
+	t.Helper()
+	commitments := make([]NonceCommitment, 0, len(req.Commitments))
+	for _, data := range req.Commitments {
+		commitment, err := NonceCommitmentFromBytes(data)
+		if err != nil {
+			t.Fatal(err)
+		}
+		commitments = append(commitments, commitment)
+	}
+	round, err := newPreprocessedRound(shares, req.SignBytes, commitments)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return round.aggregate(shares, req.SignBytes, zs)
+}
+
+func TestPreprocessedSign(t *testing.T) {
+	for _, size := range []struct{ cosigners, threshold int }{{3, 1}, {5, 2}} {
+		t.Run(fmt.Sprintf("%d-of-%d", size.threshold+1, size.cosigners), func(t *testing.T) {
+			cosigners := newTestCosigners(t, size.cosigners, size.threshold)
+			// any threshold+1 cosigners, the coordinator among them
+			var partyIDs []byte
+			for id := size.cosigners; len(partyIDs) <= size.threshold; id-- {
+				partyIDs = append(partyIDs, byte(id))
+			}
+			coordinator := partyIDs[0]
+			signBytes := testVote(1, "a", time.Now())
+			req, zs := signPreprocessed(t, cosigners, coordinator, partyIDs, signBytes)
+			signature, err := aggregatePreprocessed(t, cosigners[0].kgOutput.Shares, req, zs)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !cosigners[0].pubKey().VerifySignature(signBytes, signature.ToEd25519()) {
+				t.Error("signature does not verify under the group key")
+			}
+		})
+	}
+}
+
+func TestPreprocessedSignAttributesInvalidShare(t *testing.T) {
+	cosigners := newTestCosigners(t, 3, 1)
+	req, zs := signPreprocessed(t, cosigners, 1, []byte{1, 2}, testVote(1, "a", time.Now()))
+	zs[2].Add(zs[2], edwards25519.NewScalar().Set(zs[1]))
+	_, err := aggregatePreprocessed(t, cosigners[0].kgOutput.Shares, req, zs)
+	var protocolErr *ProtocolError
+	if !errors.As(err, &protocolErr) || protocolErr.Culprit != 2 {
+		t.Errorf("got error %v, want a ProtocolError with culprit 2", err)
+	}
+}
+
+func TestPreprocessedSignRefusesUsedCommitment(t *testing.T) {
+	cosigners := newTestCosigners(t, 3, 1)
+	req, _ := signPreprocessed(t, cosigners, 1, []byte{1, 2}, testVote(1, "a", time.Now()))
+	for _, id := range []byte{1, 2} {
+		if _, err := cosigners[id-1].SignPreprocessed(context.Background(), req); !errors.Is(err, ErrUnknownCommitment) {
+			t.Errorf("cosigner %d: got error %v signing with a used commitment, want %v", id, err, ErrUnknownCommitment)
+		}
+	}
+}
+
+func TestNoncePool(t *testing.T) {
+	pool, err := newNoncePool()
+	if err != nil {
+		t.Fatal(err)
+	}
+	commitment := func(coordinator byte) NonceCommitment {
+		commitments, err := pool.commit(1, coordinator, 1)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return commitments[0]
+	}
+
+	// another coordinator takes up its whole share of the pool
+	kept := commitment(2)
+	for i := 0; i < maxNoncesPerCoordinator; i++ {
+		commitment(3)
+	}
+	if _, err := pool.take(kept, 2); err != nil {
+		t.Errorf("got error %v for the commitment of another coordinator", err)
+	}
+	if _, err := pool.take(kept, 2); !errors.Is(err, ErrUnknownCommitment) {
+		t.Errorf("got error %v for a used commitment, want %v", err, ErrUnknownCommitment)
+	}
+
+	// the coordinator going beyond its share loses its oldest commitment
+	oldest := commitment(2)
+	for i := 0; i < maxNoncesPerCoordinator; i++ {
+		commitment(2)
+	}
+	if _, err := pool.take(oldest, 2); !errors.Is(err, ErrUnknownCommitment) {
+		t.Errorf("got error %v for a dropped commitment, want %v", err, ErrUnknownCommitment)
+	}
+
+	// commitments can only be used by the coordinator they were handed out to
+	other := commitment(2)
+	if _, err := pool.take(other, 3); !errors.Is(err, ErrUnknownCommitment) {
+		t.Errorf("got error %v for the commitment of another coordinator, want %v", err, ErrUnknownCommitment)
+	}
+}
@@ -3,8 +3,13 @@
 package signer
 
 import (
+	"bytes"
+	"context"
+	"errors"
 	"fmt"
 	"net"
+	"sync"
+	"sync/atomic"
 	"time"
 
 	tmCryptoEd2219 "github.com/tendermint/tendermint/crypto/ed25519"
@@ -19,6 +24,13 @@ import (
 	tm "github.com/tendermint/tendermint/types"
 )
 
+// reservingPrivValidator is a PrivValidator telling whether it re-served
+// an existing signature instead of producing one
+type reservingPrivValidator interface {
+	signVote(chainID string, vote *tmProto.Vote) (bool, error)
+	signProposal(chainID string, proposal *tmProto.Proposal) (bool, error)
+}
+
 // ReconnRemoteSigner dials using its dialer and responds to any
 // signature requests using its privVal.
 type ReconnRemoteSigner struct {
@@ -30,6 +42,25 @@ type ReconnRemoteSigner struct {
 	privVal tm.PrivValidator
 
 	dialer net.Dialer
+	// deadline of the handshake and of writing a reply
+	writeTimeout time.Duration
+	// the connection is dialed again if no request arrives for this long
+	idleTimeout time.Duration
+	// backoff between the attempts to connect
+	reconnect ReconnectConfig
+
+	// done when the service stops
+	ctx    context.Context
+	cancel context.CancelFunc
+
+	connected int32
+	// the current connection, closed by Reconnect
+	conn    net.Conn
+	connMtx sync.Mutex
+
+	audit *AuditLog
+	// faults injected into the replies in chaos mode, nil otherwise
+	faults *FaultInjector
 }
 
 // NewReconnRemoteSigner return a ReconnRemoteSigner that will dial using the given
@@ -50,6 +81,9 @@ func NewReconnRemoteSigner(
 		privVal: privVal,
 		dialer:  dialer,
 		privKey: tmCryptoEd2219.GenPrivKey(),
+
+		writeTimeout: defaultWriteTimeout,
+		idleTimeout:  defaultIdleTimeout,
 	}
 
 	rs.BaseService = *tmService.NewBaseService(logger, "RemoteSigner", rs)
@@ -58,42 +92,174 @@ func NewReconnRemoteSigner(
 
 // OnStart implements cmn.Service.
 func (rs *ReconnRemoteSigner) OnStart() error {
+	rs.ctx, rs.cancel = context.WithCancel(context.Background())
+	rs.setConn(nil)
 	go rs.loop()
 	return nil
 }
 
+// OnStop implements cmn.Service. It interrupts dialing, waiting to retry
+// and waiting for a request, so that the loop exits right away.
+func (rs *ReconnRemoteSigner) OnStop() {
+	rs.cancel()
+	rs.connMtx.Lock()
+	defer rs.connMtx.Unlock()
+	if rs.conn != nil {
+		rs.conn.Close()
+	}
+}
+
+// setConn records the current connection to the node, nil if there is none
+func (rs *ReconnRemoteSigner) setConn(conn net.Conn) {
+	rs.connMtx.Lock()
+	rs.conn = conn
+	rs.connMtx.Unlock()
+	var value int32
+	if conn != nil {
+		value = 1
+	}
+	atomic.StoreInt32(&rs.connected, value)
+	metricNodeConnected.WithLabelValues(rs.chainID, rs.address).Set(float64(value))
+}
+
+// SetAuditLog sets the log the outcome of every sign request from the node is recorded in.
+// It must be called before the service is started.
+func (rs *ReconnRemoteSigner) SetAuditLog(audit *AuditLog) {
+	rs.audit = audit
+}
+
+// SetTimeouts sets the deadline of the handshake and of writing a reply, and how long the
+// connection may go without a request before it is dialed again.
+// It must be called before the service is started.
+func (rs *ReconnRemoteSigner) SetTimeouts(writeTimeout time.Duration, idleTimeout time.Duration) {
+	rs.writeTimeout = writeTimeout
+	rs.idleTimeout = idleTimeout
+}
+
+// SetReconnect sets the backoff between the attempts to connect to the node.
+// It must be called before the service is started.
+func (rs *ReconnRemoteSigner) SetReconnect(reconnect ReconnectConfig) {
+	rs.reconnect = reconnect
+}
+
+// connEvent counts an event of the connection to the node
+func (rs *ReconnRemoteSigner) connEvent(event string) {
+	metricNodeConnectionEvents.WithLabelValues(rs.chainID, rs.address, event).Inc()
+}
+
+// SetFaultInjector sets the faults injected into the replies to the node.
+// It must be called before the service is started.
+func (rs *ReconnRemoteSigner) SetFaultInjector(faults *FaultInjector) {
+	rs.faults = faults
+}
+
+// recordDecision records the outcome of a sign request from the node in the audit log.
+// If it cannot be recorded, the node must get the error returned instead of the signature.
+func (rs *ReconnRemoteSigner) recordDecision(request string, signBytes []byte, reserved bool, err error) error {
+	decision := AuditSigned
+	if err != nil {
+		decision = AuditRefused
+	} else if reserved {
+		decision = AuditReserved
+	}
+	return rs.audit.Record("node:"+rs.address, request, signBytes, decision, err)
+}
+
+// signVote signs the vote with the privVal, and returns whether the signature was re-served
+func (rs *ReconnRemoteSigner) signVote(vote *tmProto.Vote) (bool, error) {
+	if vote == nil {
+		return false, fmt.Errorf("%w: no vote", ErrInvalidRequest)
+	}
+	if privVal, ok := rs.privVal.(reservingPrivValidator); ok {
+		return privVal.signVote(rs.chainID, vote)
+	}
+	return false, rs.privVal.SignVote(rs.chainID, vote)
+}
+
+// signProposal signs the proposal with the privVal, and returns whether the signature was re-served
+func (rs *ReconnRemoteSigner) signProposal(proposal *tmProto.Proposal) (bool, error) {
+	if proposal == nil {
+		return false, fmt.Errorf("%w: no proposal", ErrInvalidRequest)
+	}
+	if privVal, ok := rs.privVal.(reservingPrivValidator); ok {
+		return privVal.signProposal(rs.chainID, proposal)
+	}
+	return false, rs.privVal.SignProposal(rs.chainID, proposal)
+}
+
+// IsConnected returns whether the connection to the node is established
+func (rs *ReconnRemoteSigner) IsConnected() bool {
+	return atomic.LoadInt32(&rs.connected) == 1
+}
+
+// Reconnect closes the current connection to the node, so that it is dialed again
+func (rs *ReconnRemoteSigner) Reconnect() {
+	rs.connMtx.Lock()
+	defer rs.connMtx.Unlock()
+	if rs.conn != nil {
+		rs.Logger.Info("Reconnecting", "address", rs.address)
+		rs.conn.Close()
+	}
+}
+
+// Address returns the address of the node
+func (rs *ReconnRemoteSigner) Address() string {
+	return rs.address
+}
+
+// retry waits for the next delay of the backoff before dialing again, or until the service stops
+func (rs *ReconnRemoteSigner) retry(backoff *Backoff) {
+	delay := backoff.Next()
+	rs.Logger.Info("Retrying", "sleep", delay, "address", rs.address)
+	sleep(rs.ctx, delay)
+}
+
 // main loop for ReconnRemoteSigner
 func (rs *ReconnRemoteSigner) loop() {
 	var conn net.Conn
+	// the last reply, sent again by a reorder fault
+	var last tmProtoPrivval.Message
+	backoff := NewBackoff(rs.reconnect)
 	for {
 		if !rs.IsRunning() {
 			if conn != nil {
 				if err := conn.Close(); err != nil {
 					rs.Logger.Error("Close", "err", err.Error()+"closing listener failed")
 				}
+				rs.setConn(nil)
 			}
 			return
 		}
 
 		for conn == nil {
+			if rs.ctx.Err() != nil {
+				return
+			}
 			proto, address := tmNet.ProtocolAndAddress(rs.address)
-			netConn, err := rs.dialer.Dial(proto, address)
+			netConn, err := rs.dialer.DialContext(rs.ctx, proto, address)
 			if err != nil {
+				rs.connEvent("dial_failed")
 				rs.Logger.Error("Dialing", "err", err)
-				rs.Logger.Info("Retrying", "sleep (s)", 3, "address", rs.address)
-				time.Sleep(time.Second * 3)
+				rs.retry(backoff)
 				continue
 			}
 
-			rs.Logger.Info("Connected", "address", rs.address)
+			// a node that accepts the connection but never completes the handshake is dialed again
+			netConn.SetDeadline(time.Now().Add(rs.writeTimeout))
 			conn, err = tmP2pConn.MakeSecretConnection(netConn, rs.privKey)
 			if err != nil {
+				netConn.Close()
 				conn = nil
+				rs.connEvent("handshake_failed")
 				rs.Logger.Error("Secret Conn", "err", err)
-				rs.Logger.Info("Retrying", "sleep (s)", 3, "address", rs.address)
-				time.Sleep(time.Second * 3)
+				rs.retry(backoff)
 				continue
 			}
+			backoff.Reset()
+			netConn.SetDeadline(time.Time{})
+			rs.connEvent("connected")
+			rs.Logger.Info("Connected", "address", rs.address)
+			rs.setConn(conn)
 		}
 
 		// since dialing can take time, we check running again
@@ -101,14 +267,35 @@ func (rs *ReconnRemoteSigner) loop() {
 			if err := conn.Close(); err != nil {
 				rs.Logger.Error("Close", "err", err.Error()+"closing listener failed")
 			}
+			rs.setConn(nil)
 			return
 		}
 
+		// the node pings when it has nothing to sign, so a connection without
+		// requests is half-open: the node went away without closing it
+		conn.SetReadDeadline(time.Now().Add(rs.idleTimeout))
 		req, err := ReadMsg(conn)
 		if err != nil {
-			rs.Logger.Error("readMsg", "err", err)
+			var netErr net.Error
+			switch {
+			case errors.As(err, &netErr) && netErr.Timeout():
+				rs.connEvent("idle_timeout")
+				rs.Logger.Error("No request from the node, reconnecting", "address", rs.address, "idle", rs.idleTimeout)
+			case errors.Is(err, net.ErrClosed):
+				rs.connEvent("closed")
+				rs.Logger.Info("Connection closed", "address", rs.address)
+			default:
+				rs.connEvent("read_error")
+				rs.Logger.Error("readMsg", "err", err)
+			}
 			conn.Close()
 			conn = nil
+			rs.setConn(nil)
+			continue
+		}
+
+		fault := rs.faults.nodeFault(rs.address)
+		if fault.dropsRequest() {
 			continue
 		}
 
@@ -118,11 +305,41 @@ func (rs *ReconnRemoteSigner) loop() {
 			rs.Logger.Error("handleRequest", "err", err)
 		}
 
-		err = WriteMsg(conn, res)
+		if fault.fault != FaultNone || fault.delay > 0 {
+			rs.Logger.Info("Injecting fault", "address", rs.address, "fault", fault.fault, "delay", fault.delay)
+		}
+		if !sleep(rs.ctx, fault.delay) {
+			// stopped: the connection is closed at the top of the loop
+			continue
+		}
+		conn.SetWriteDeadline(time.Now().Add(rs.writeTimeout))
+		switch fault.fault {
+		case FaultCrash:
+			// the connection goes down with the reply, and is only dialed again once the crash is over
+			conn.Close()
+			conn = nil
+			rs.setConn(nil)
+			sleep(rs.ctx, fault.crashDuration())
+			continue
+		case FaultDropReply:
+			continue
+		case FaultGarbage:
+			_, err = conn.Write(bytes.Join(fault.garbage(), nil))
+		case FaultReorder:
+			if last.Sum == nil {
+				last = res
+			}
+			err = WriteMsg(conn, last)
+		default:
+			err = WriteMsg(conn, res)
+		}
+		last = res
 		if err != nil {
+			rs.connEvent("write_error")
 			rs.Logger.Error("writeMsg", "err", err)
 			conn.Close()
 			conn = nil
+			rs.setConn(nil)
 		}
 	}
 }
@@ -139,7 +356,7 @@ func (rs *ReconnRemoteSigner) handleRequest(req tmProtoPrivval.Message) (tmProto
 			msg.Sum = &tmProtoPrivval.Message_PubKeyResponse{PubKeyResponse: &tmProtoPrivval.PubKeyResponse{
 				PubKey: tmProtoCrypto.PublicKey{},
 				Error: &tmProtoPrivval.RemoteSignerError{
-					Code:        0,
+					Code:        ErrorCode(err),
 					Description: err.Error(),
 				},
 			}}
@@ -150,7 +367,7 @@ func (rs *ReconnRemoteSigner) handleRequest(req tmProtoPrivval.Message) (tmProto
 				msg.Sum = &tmProtoPrivval.Message_PubKeyResponse{PubKeyResponse: &tmProtoPrivval.PubKeyResponse{
 					PubKey: tmProtoCrypto.PublicKey{},
 					Error: &tmProtoPrivval.RemoteSignerError{
-						Code:        0,
+						Code:        ErrorCode(err),
 						Description: err.Error(),
 					},
 				}}
@@ -159,14 +376,22 @@ func (rs *ReconnRemoteSigner) handleRequest(req tmProtoPrivval.Message) (tmProto
 			}
 		}
 	case *tmProtoPrivval.Message_SignVoteRequest:
-		vote := typedReq.SignVoteRequest.Vote
-		err = rs.privVal.SignVote(rs.chainID, vote)
+		vote := typedReq.SignVoteRequest.GetVote()
+		var signBytes []byte
+		if vote != nil {
+			signBytes = tm.VoteSignBytes(rs.chainID, vote)
+		}
+		var reserved bool
+		reserved, err = rs.signVote(vote)
+		if auditErr := rs.recordDecision("sign_vote", signBytes, reserved, err); auditErr != nil {
+			err = auditErr
+		}
 		if err != nil {
 			rs.Logger.Error("Failed to sign vote", "address", rs.address, "error", err, "vote", vote)
 			msg.Sum = &tmProtoPrivval.Message_SignedVoteResponse{SignedVoteResponse: &tmProtoPrivval.SignedVoteResponse{
 				Vote: tmProto.Vote{},
 				Error: &tmProtoPrivval.RemoteSignerError{
-					Code:        0,
+					Code:        ErrorCode(err),
 					Description: err.Error(),
 				},
 			}}
@@ -175,14 +400,22 @@ func (rs *ReconnRemoteSigner) handleRequest(req tmProtoPrivval.Message) (tmProto
 			msg.Sum = &tmProtoPrivval.Message_SignedVoteResponse{SignedVoteResponse: &tmProtoPrivval.SignedVoteResponse{Vote: *vote, Error: nil}}
 		}
 	case *tmProtoPrivval.Message_SignProposalRequest:
-		proposal := typedReq.SignProposalRequest.Proposal
-		err = rs.privVal.SignProposal(rs.chainID, typedReq.SignProposalRequest.Proposal)
+		proposal := typedReq.SignProposalRequest.GetProposal()
+		var signBytes []byte
+		if proposal != nil {
+			signBytes = tm.ProposalSignBytes(rs.chainID, proposal)
+		}
+		var reserved bool
+		reserved, err = rs.signProposal(proposal)
+		if auditErr := rs.recordDecision("sign_proposal", signBytes, reserved, err); auditErr != nil {
+			err = auditErr
+		}
 		if err != nil {
 			rs.Logger.Error("Failed to sign proposal", "address", rs.address, "error", err, "proposal", proposal)
 			msg.Sum = &tmProtoPrivval.Message_SignedProposalResponse{SignedProposalResponse: &tmProtoPrivval.SignedProposalResponse{
 				Proposal: tmProto.Proposal{},
 				Error: &tmProtoPrivval.RemoteSignerError{
-					Code:        0,
+					Code:        ErrorCode(err),
 					Description: err.Error(),
 				},
 			}}
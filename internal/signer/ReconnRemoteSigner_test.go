@@ -0,0 +1,50 @@
+package signer
+
+import (
+	"net"
+	"testing"
+
+	tmLog "github.com/tendermint/tendermint/libs/log"
+	tmProtoPrivval "github.com/tendermint/tendermint/proto/tendermint/privval"
+	tmProto "github.com/tendermint/tendermint/proto/tendermint/types"
+)
+
+func TestHandleMalformedRequest(t *testing.T) {
+	validator := NewThresholdValidator(newTestCosigners(t, 3, 1)[0], newTestRemoteCosigners(t))
+	rs := NewReconnRemoteSigner("tcp://127.0.0.1:1", tmLog.NewNopLogger(), testChainID, validator, net.Dialer{})
+
+	for _, tc := range []struct {
+		name    string
+		request tmProtoPrivval.Message
+	}{
+		{"no vote", tmProtoPrivval.Message{Sum: &tmProtoPrivval.Message_SignVoteRequest{
+			SignVoteRequest: &tmProtoPrivval.SignVoteRequest{ChainId: testChainID},
+		}}},
+		{"no vote request", tmProtoPrivval.Message{Sum: &tmProtoPrivval.Message_SignVoteRequest{}}},
+		{"unknown vote type", tmProtoPrivval.Message{Sum: &tmProtoPrivval.Message_SignVoteRequest{
+			SignVoteRequest: &tmProtoPrivval.SignVoteRequest{
+				Vote:    &tmProto.Vote{Type: tmProto.ProposalType, Height: 1},
+				ChainId: testChainID,
+			},
+		}}},
+		{"no proposal", tmProtoPrivval.Message{Sum: &tmProtoPrivval.Message_SignProposalRequest{
+			SignProposalRequest: &tmProtoPrivval.SignProposalRequest{ChainId: testChainID},
+		}}},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			res, _ := rs.handleRequest(tc.request)
+			var refusal *tmProtoPrivval.RemoteSignerError
+			switch sum := res.Sum.(type) {
+			case *tmProtoPrivval.Message_SignedVoteResponse:
+				refusal = sum.SignedVoteResponse.Error
+			case *tmProtoPrivval.Message_SignedProposalResponse:
+				refusal = sum.SignedProposalResponse.Error
+			default:
+				t.Fatalf("got reply %T", res.Sum)
+			}
+			if refusal == nil || refusal.Code != ErrorCode(ErrInvalidRequest) {
+				t.Errorf("got refusal %v, want code %d", refusal, ErrorCode(ErrInvalidRequest))
+			}
+		})
+	}
+}
@@ -0,0 +1,149 @@
+package signer
+
+import (
+	"fmt"
+	"reflect"
+	"sync"
+	"time"
+
+	tmLog "github.com/tendermint/tendermint/libs/log"
+)
+
+// Reloader applies changes of the configuration file to the running chains.
+//
+// The node connections, the session timeout and the peer addresses are updated in place.
+// Changes to the key material, the chain IDs, the cosigner identity or the listen addresses
+// need a restart and are refused.
+type Reloader struct {
+	logger tmLog.Logger
+	path   string
+	chains []*Chain
+
+	mtx    sync.Mutex
+	config CoConfig
+}
+
+// NewReloader returns a Reloader for the chains started from config, which was loaded from path
+func NewReloader(logger tmLog.Logger, path string, config CoConfig, chains []*Chain) *Reloader {
+	return &Reloader{
+		logger: logger,
+		path:   path,
+		chains: chains,
+		config: config,
+	}
+}
+
+// Reload reads the configuration file again and applies it
+func (r *Reloader) Reload() error {
+	r.mtx.Lock()
+	defer r.mtx.Unlock()
+	next, err := LoadConfigFromFile(r.path)
+	if err != nil {
+		return err
+	}
+	if err := next.Validate(); err != nil {
+		return err
+	}
+	if err := CheckReload(r.config, next); err != nil {
+		return err
+	}
+	// every chain is checked before any is changed, so that a refused reload changes nothing
+	chainConfigs := make([]ChainConfig, len(r.chains))
+	for i, chain := range r.chains {
+		chainConfig, err := next.FindChain(chain.ChainID())
+		if err != nil {
+			return err
+		}
+		if err := chain.Peers.CheckPeers(next.Cosigners); err != nil {
+			return fmt.Errorf("chain %q: %w", chain.ChainID(), err)
+		}
+		chainConfigs[i] = chainConfig
+	}
+
+	// failing to add or remove a node does not stop the other changes:
+	// the next reload adds or removes it again
+	timeout := time.Duration(next.SessionTimeoutSec * int(time.Second))
+	var firstErr error
+	for i, chain := range r.chains {
+		chain.Local.SetTimeout(timeout)
+		chain.Peers.SetTimeout(timeout)
+		if err := chain.Peers.UpdatePeers(next.Cosigners); err != nil && firstErr == nil {
+			firstErr = fmt.Errorf("chain %q: %w", chain.ChainID(), err)
+		}
+		if err := chain.SetNodes(chainConfigs[i].Nodes); err != nil && firstErr == nil {
+			firstErr = fmt.Errorf("chain %q: %w", chain.ChainID(), err)
+		}
+	}
+	r.config = next
+	if firstErr != nil {
+		return firstErr
+	}
+	r.logger.Info("Reloaded config", "path", r.path)
+	return nil
+}
+
+// CheckReload returns an error if next changes settings of current that cannot be applied without a restart
+func CheckReload(current, next CoConfig) error {
+	if current.CosignerId != next.CosignerId {
+		return fmt.Errorf("cannot change cosigner_id on reload")
+	}
+	if current.CosignerThreshold != next.CosignerThreshold {
+		return fmt.Errorf("cannot change cosigner_threshold on reload")
+	}
+	if current.ListenAddress != next.ListenAddress {
+		return fmt.Errorf("cannot change cosigner_listen_address on reload")
+	}
+	if current.HttpListenAddress != next.HttpListenAddress {
+		return fmt.Errorf("cannot change http_listen_address on reload")
+	}
+	if current.AdminSocket != next.AdminSocket {
+		return fmt.Errorf("cannot change admin_socket on reload")
+	}
+	if current.AuditLogFile != next.AuditLogFile {
+		return fmt.Errorf("cannot change audit_log_file on reload")
+	}
+	if !reflect.DeepEqual(current.Tracing, next.Tracing) {
+		return fmt.Errorf("cannot change tracing on reload")
+	}
+	if !reflect.DeepEqual(current.Chaos, next.Chaos) {
+		return fmt.Errorf("cannot change chaos on reload")
+	}
+	if current.NodeConnection != next.NodeConnection {
+		return fmt.Errorf("cannot change node_connection on reload")
+	}
+	if !reflect.DeepEqual(current.Reconnect, next.Reconnect) {
+		return fmt.Errorf("cannot change reconnect on reload")
+	}
+
+	currentChains := current.ChainConfigs()
+	nextChains := next.ChainConfigs()
+	if len(currentChains) != len(nextChains) {
+		return fmt.Errorf("cannot add or remove chains on reload")
+	}
+	for _, chain := range currentChains {
+		nextChain, err := next.FindChain(chain.ChainID)
+		if err != nil {
+			return fmt.Errorf("cannot add or remove chains on reload: %w", err)
+		}
+		if chain.KeySharePath != nextChain.KeySharePath {
+			return fmt.Errorf("cannot change key_share_file of chain %q on reload", chain.ChainID)
+		}
+		if chain.PrivValStateFile != nextChain.PrivValStateFile {
+			return fmt.Errorf("cannot change state_file of chain %q on reload", chain.ChainID)
+		}
+	}
+
+	if len(current.Cosigners) != len(next.Cosigners) {
+		return fmt.Errorf("cannot add or remove cosigners on reload")
+	}
+	ids := make(map[int]bool, len(current.Cosigners))
+	for _, cosigner := range current.Cosigners {
+		ids[cosigner.ID] = true
+	}
+	for _, cosigner := range next.Cosigners {
+		if !ids[cosigner.ID] {
+			return fmt.Errorf("cannot add or remove cosigners on reload: unknown cosigner %d", cosigner.ID)
+		}
+	}
+	return nil
+}
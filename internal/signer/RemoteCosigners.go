@@ -2,215 +2,805 @@ package signer
 
 import (
 	"bytes"
+	"context"
 	"errors"
+	"fmt"
+	"strconv"
+	"sync"
 	"time"
 
 	zmq "github.com/pebbe/zmq4"
+	"github.com/taurusgroup/frost-ed25519/pkg/frost/party"
+	"github.com/taurusgroup/frost-ed25519/pkg/messages"
+	tmlog "github.com/tendermint/tendermint/libs/log"
+	tmService "github.com/tendermint/tendermint/libs/service"
 )
 
 // RemoteCosigners maintains the connections to the remote nodes
 // and collects responses from them
 //
-// NOT thread safe
+// Each request to a peer takes a socket of its own from a pool, so that the
+// sessions of different HRS run concurrently: REQ sockets only allow one request
+// in flight. The mutex guards the pools and the status of the peers; it is not
+// held while waiting for replies.
+//
+// Stopping it aborts the requests in flight and closes the sockets.
 type RemoteCosigners struct {
-	Context        *zmq.Context
-	Clients        map[*zmq.Socket]byte
-	ActiveClients  map[*zmq.Socket]byte
-	SessionClients map[*zmq.Socket]byte
-	Poller         *zmq.Poller
-	LocalID        byte
-	Threshold      int
-	timeout        time.Duration
+	tmService.BaseService
+	Context   *zmq.Context
+	LocalID   byte
+	Threshold int
+
+	mtx     sync.Mutex
+	timeout time.Duration
+	peers   []*remotePeer
+	// backoff between the attempts to reach a peer that failed to reply
+	reconnect ReconnectConfig
+
+	// faults injected into the requests in chaos mode, nil otherwise
+	faults *FaultInjector
+	audit  *AuditLog
+
+	// canceled by OnStop: no request is sent afterwards, and the ones in flight are aborted
+	ctx    context.Context
+	cancel context.CancelFunc
+	// requests and pings holding a socket, waited for before the context is terminated
+	inflight sync.WaitGroup
+}
+
+// how often a request waiting for its reply checks whether the cosigners were stopped
+const peerPollInterval = 100 * time.Millisecond
+
+// peers that failed this many signing rounds are only chosen by ResetParties
+// when there are not enough well-behaved peers, until misbehaviorCooldown passed
+// since their last misbehavior
+const (
+	misbehaviorLimit    = 3
+	misbehaviorCooldown = time.Minute
+)
+
+// remotePeer is the connection state of a peer cosigner
+type remotePeer struct {
+	config CosignerConfig
+	// sockets connected to the peer without a request in flight
+	idle []*zmq.Socket
+	// incremented when the address changes or the connection is reset,
+	// so that sockets of an earlier connection are not put back in the pool
+	generation int
+	// false after the peer failed to reply, until the next ResetParties
+	active    bool
+	lastReply time.Time
+	latencies map[string]time.Duration
+	// signing rounds that failed because of an invalid message of the peer,
+	// until the peer takes part in a signing round that succeeds or the connection is reset
+	misbehavior     int
+	lastMisbehavior time.Time
+	// after a failed request, no request is sent to the peer before retryAt
+	backoff *Backoff
+	retryAt time.Time
+}
+
+// errBackingOff is returned for requests to a peer that is not retried yet
+var errBackingOff = errors.New("waiting to retry the cosigner")
+
+// PeerStatus describes the connection to a peer cosigner
+type PeerStatus struct {
+	ID          byte      `json:"id"`
+	Address     string    `json:"address"`
+	Active      bool      `json:"active"`
+	LastReply   time.Time `json:"last_reply"`
+	Misbehavior int       `json:"misbehavior"`
 }
 
 func NewRemoteCosigners(cfg CoConfig) (*RemoteCosigners, error) {
-	context, err := zmq.NewContext()
+	zmqContext, err := zmq.NewContext()
 	if err != nil {
 		return nil, err
 	}
-	var poller *zmq.Poller = zmq.NewPoller()
-	clients := make(map[*zmq.Socket]byte)
-	activeClients := make(map[*zmq.Socket]byte)
-	sessionClients := make(map[*zmq.Socket]byte)
+	peers := make([]*remotePeer, 0, len(cfg.Cosigners))
 	for _, cosigner := range cfg.Cosigners {
-		// FIXME: close clients on shutdown
-		client, err := context.NewSocket(zmq.REQ)
-		if err != nil {
-			return nil, err
-		}
-		client.Connect(cosigner.Address)
-		poller.Add(client, zmq.POLLIN)
-		clients[client] = byte(cosigner.ID)
-		activeClients[client] = byte(cosigner.ID)
+		peers = append(peers, &remotePeer{
+			config:    cosigner,
+			active:    true,
+			latencies: make(map[string]time.Duration),
+			backoff:   NewBackoff(cfg.Reconnect),
+		})
 	}
 	cosigner := &RemoteCosigners{
-		Context:        context,
-		Clients:        clients,
-		ActiveClients:  activeClients,
-		SessionClients: sessionClients,
-		Poller:         poller,
-		LocalID:        cfg.CosignerId,
-		Threshold:      int(cfg.CosignerThreshold),
-		timeout:        time.Duration(cfg.SessionTimeoutSec * int(time.Second)),
+		Context:   zmqContext,
+		LocalID:   cfg.CosignerId,
+		Threshold: int(cfg.CosignerThreshold),
+		timeout:   time.Duration(cfg.SessionTimeoutSec * int(time.Second)),
+		peers:     peers,
+		reconnect: cfg.Reconnect,
 	}
+	cosigner.ctx, cosigner.cancel = context.WithCancel(context.Background())
+	cosigner.BaseService = *tmService.NewBaseService(tmlog.NewNopLogger(), "RemoteCosigners", cosigner)
 	return cosigner, nil
 }
 
-func (cosigners *RemoteCosigners) ResetParties() []byte {
-	parties_arr := make([]byte, cosigners.Threshold+1)
+// OnStop implements cmn.Service.
+// It waits for the requests in flight, which return within peerPollInterval once aborted.
+func (cosigners *RemoteCosigners) OnStop() {
+	cosigners.mtx.Lock()
+	cosigners.cancel()
+	cosigners.mtx.Unlock()
+	cosigners.inflight.Wait()
+
+	cosigners.mtx.Lock()
+	for _, peer := range cosigners.peers {
+		peer.closeIdle()
+	}
+	cosigners.mtx.Unlock()
+	if err := cosigners.Context.Term(); err != nil {
+		cosigners.Logger.Error("Terminating context", "err", err)
+	}
+}
 
-	if len(cosigners.ActiveClients) < cosigners.Threshold {
-		for k, v := range cosigners.Clients {
-			cosigners.ActiveClients[k] = v
+// begin registers a request or ping about to use a socket,
+// failing once the cosigners are stopped. It must be called with the mutex held.
+func (cosigners *RemoteCosigners) begin() error {
+	if cosigners.ctx.Err() != nil {
+		return ErrShuttingDown
+	}
+	cosigners.inflight.Add(1)
+	return nil
+}
+
+// peer returns the peer with the ID. It must be called with the mutex held.
+func (cosigners *RemoteCosigners) peer(id byte) *remotePeer {
+	for _, peer := range cosigners.peers {
+		if byte(peer.config.ID) == id {
+			return peer
 		}
-		polled, _ := cosigners.Poller.Poll(cosigners.timeout)
+	}
+	return nil
+}
 
-		for _, item := range polled {
-			if item.Events&zmq.POLLIN != 0 {
-				item.Socket.RecvMessageBytes(0)
-			}
+// Status returns the state of the connection to each peer
+func (cosigners *RemoteCosigners) Status() []PeerStatus {
+	cosigners.mtx.Lock()
+	defer cosigners.mtx.Unlock()
+	statuses := make([]PeerStatus, 0, len(cosigners.peers))
+	for _, peer := range cosigners.peers {
+		statuses = append(statuses, PeerStatus{
+			ID:          byte(peer.config.ID),
+			Address:     peer.config.Address,
+			Active:      peer.active,
+			LastReply:   peer.lastReply,
+			Misbehavior: peer.misbehavior,
+		})
+	}
+	return statuses
+}
+
+// Latencies returns how long the last reply of each peer to each request
+// ("start_session", "end_session", "sign" or "set_signature") took
+func (cosigners *RemoteCosigners) Latencies() map[byte]map[string]time.Duration {
+	cosigners.mtx.Lock()
+	defer cosigners.mtx.Unlock()
+	latencies := make(map[byte]map[string]time.Duration, len(cosigners.peers))
+	for _, peer := range cosigners.peers {
+		if len(peer.latencies) == 0 {
+			continue
+		}
+		requests := make(map[string]time.Duration, len(peer.latencies))
+		for request, latency := range peer.latencies {
+			requests[request] = latency
+		}
+		latencies[byte(peer.config.ID)] = requests
+	}
+	return latencies
+}
+
+// Reconnect drops the connections to the peer; the next request opens a new one.
+// Requests in flight finish on their own sockets, which are closed afterwards.
+// The misbehavior of the peer is forgiven.
+func (cosigners *RemoteCosigners) Reconnect(id byte) error {
+	cosigners.mtx.Lock()
+	defer cosigners.mtx.Unlock()
+	peer := cosigners.peer(id)
+	if peer == nil {
+		return fmt.Errorf("unknown cosigner %d", id)
+	}
+	peer.reset()
+	return nil
+}
+
+// reset closes the idle sockets of the peer and invalidates the ones in use.
+// It must be called with the mutex held.
+func (peer *remotePeer) reset() {
+	peer.closeIdle()
+	peer.generation++
+	peer.active = true
+	peer.misbehavior = 0
+	peer.backoff.Reset()
+	peer.retryAt = time.Time{}
+}
+
+// closeIdle closes the sockets in the pool of the peer. It must be called with the mutex held.
+func (peer *remotePeer) closeIdle() {
+	for _, socket := range peer.idle {
+		socket.SetLinger(0)
+		socket.Close()
+	}
+	peer.idle = nil
+}
+
+// SetAuditLog sets the log the misbehavior of the peers is recorded in.
+// It must be called before the first request.
+func (cosigners *RemoteCosigners) SetAuditLog(audit *AuditLog) {
+	cosigners.audit = audit
+}
+
+// RecordMisbehavior records that the peer made the signing round of the request fail.
+// The peer is no longer active, and once it misbehaved misbehaviorLimit times
+// it is left out of the sessions as long as enough other peers are available,
+// for misbehaviorCooldown after its last misbehavior.
+func (cosigners *RemoteCosigners) RecordMisbehavior(id byte, request string, signBytes []byte, err error) {
+	cosigners.mtx.Lock()
+	if peer := cosigners.peer(id); peer != nil {
+		peer.misbehavior++
+		peer.lastMisbehavior = time.Now()
+		peer.active = false
+	}
+	cosigners.mtx.Unlock()
+	metricPeerMisbehavior.WithLabelValues(peerLabel(id), request).Inc()
+	if auditErr := cosigners.audit.Record("peer:"+peerLabel(id), request, signBytes, AuditMisbehaved, err); auditErr != nil {
+		cosigners.Logger.Error("Failed to record misbehavior", "peer", id, "error", auditErr)
+	}
+}
+
+// RecordSuccess records that the peers took part in a signing round that succeeded,
+// which clears their misbehavior
+func (cosigners *RemoteCosigners) RecordSuccess(ids []byte) {
+	cosigners.mtx.Lock()
+	defer cosigners.mtx.Unlock()
+	for _, id := range ids {
+		if peer := cosigners.peer(id); peer != nil {
+			peer.misbehavior = 0
+		}
+	}
+}
+
+// SetTimeout changes how long to wait for the replies of the peers
+func (cosigners *RemoteCosigners) SetTimeout(timeout time.Duration) {
+	cosigners.mtx.Lock()
+	defer cosigners.mtx.Unlock()
+	cosigners.timeout = timeout
+}
+
+// CheckPeers returns an error if UpdatePeers would refuse the peers
+func (cosigners *RemoteCosigners) CheckPeers(peers []CosignerConfig) error {
+	cosigners.mtx.Lock()
+	defer cosigners.mtx.Unlock()
+	return cosigners.checkPeers(peers)
+}
+
+func (cosigners *RemoteCosigners) checkPeers(peers []CosignerConfig) error {
+	if len(peers) != len(cosigners.peers) {
+		return fmt.Errorf("cannot change the number of cosigners from %d to %d", len(cosigners.peers), len(peers))
+	}
+	for _, config := range peers {
+		if cosigners.peer(byte(config.ID)) == nil {
+			return fmt.Errorf("unknown cosigner %d", config.ID)
 		}
 	}
-	cosigners.SessionClients = make(map[*zmq.Socket]byte)
-	i := 0
-	for socket, partyI := range cosigners.ActiveClients {
-		parties_arr[i] = partyI
-		cosigners.SessionClients[socket] = partyI
-		i++
-		if i == cosigners.Threshold {
-			break
+	return nil
+}
+
+// UpdatePeers reconnects to the peers whose address changed.
+// The set of peer IDs must stay the same.
+func (cosigners *RemoteCosigners) UpdatePeers(peers []CosignerConfig) error {
+	cosigners.mtx.Lock()
+	defer cosigners.mtx.Unlock()
+	if err := cosigners.checkPeers(peers); err != nil {
+		return err
+	}
+	for _, config := range peers {
+		peer := cosigners.peer(byte(config.ID))
+		if peer.config.Address != config.Address {
+			peer.config = config
+			peer.reset()
 		}
 	}
-	parties_arr[cosigners.Threshold] = cosigners.LocalID
+	return nil
+}
+
+// PingResult is the outcome of pinging a peer
+type PingResult struct {
+	Pong CosignerPongResponse
+	RTT  time.Duration
+	Err  error
+}
+
+// Ping checks concurrently which of the peers answer a ping within the timeout.
+// It uses its own sockets, so it may be called while a signing session is in progress.
+func (cosigners *RemoteCosigners) Ping(timeout time.Duration) map[byte]error {
+	results := cosigners.PingDetails(timeout)
+	pings := make(map[byte]error, len(results))
+	for id, result := range results {
+		pings[id] = result.Err
+	}
+	return pings
+}
+
+// PingDetails pings the peers like Ping, returning their pongs and round-trip times
+func (cosigners *RemoteCosigners) PingDetails(timeout time.Duration) map[byte]PingResult {
+	type result struct {
+		id byte
+		PingResult
+	}
+	cosigners.mtx.Lock()
+	peers := make([]CosignerConfig, 0, len(cosigners.peers))
+	for _, peer := range cosigners.peers {
+		peers = append(peers, peer.config)
+	}
+	err := cosigners.begin()
+	cosigners.mtx.Unlock()
+	if err != nil {
+		pings := make(map[byte]PingResult, len(peers))
+		for _, peer := range peers {
+			pings[byte(peer.ID)] = PingResult{Err: err}
+		}
+		return pings
+	}
+	defer cosigners.inflight.Done()
+	results := make(chan result, len(peers))
+	for _, peer := range peers {
+		go func(peer CosignerConfig) {
+			start := time.Now()
+			pong, err := pingCosigner(cosigners.ctx, cosigners.Context, peer.Address, cosigners.LocalID, timeout)
+			results <- result{byte(peer.ID), PingResult{Pong: pong, RTT: time.Since(start), Err: err}}
+		}(peer)
+	}
+	pings := make(map[byte]PingResult, len(peers))
+	for range peers {
+		r := <-results
+		pings[r.id] = r.PingResult
+	}
+	return pings
+}
+
+func pingCosigner(ctx context.Context, zmqContext *zmq.Context, address string, localID byte, timeout time.Duration) (CosignerPongResponse, error) {
+	client, err := zmqContext.NewSocket(zmq.REQ)
+	if err != nil {
+		return CosignerPongResponse{}, err
+	}
+	defer client.Close()
+	client.SetLinger(0)
+	if err = client.Connect(address); err != nil {
+		return CosignerPongResponse{}, err
+	}
+	if _, err = client.SendMessage([][]byte{{3, localID}}); err != nil {
+		return CosignerPongResponse{}, err
+	}
+	if err = waitForReply(ctx, client, timeout); err != nil {
+		return CosignerPongResponse{}, err
+	}
+	reply, err := client.RecvMessageBytes(0)
+	if err != nil {
+		return CosignerPongResponse{}, err
+	}
+	return MsgToPong(reply)
+}
+
+// ResetParties chooses the peers of a new signing session: Threshold active peers and ourselves.
+// If fewer than Threshold well-behaved peers are active, all of them are given another chance.
+// Repeat offenders only make up for missing well-behaved peers, and peers backing off after
+// a failed request, whose requests are refused, for missing other peers.
+func (cosigners *RemoteCosigners) ResetParties() []byte {
+	cosigners.mtx.Lock()
+	defer cosigners.mtx.Unlock()
+	now := time.Now()
+	active := 0
+	for _, peer := range cosigners.peers {
+		if peer.active && peer.wellBehaved(now) && !peer.backingOff(now) {
+			active++
+		}
+	}
+	if active < cosigners.Threshold {
+		for _, peer := range cosigners.peers {
+			peer.active = true
+		}
+	}
+	parties_arr := make([]byte, 0, cosigners.Threshold+1)
+	for _, backingOff := range []bool{false, true} {
+		for _, wellBehaved := range []bool{true, false} {
+			for _, peer := range cosigners.peers {
+				if len(parties_arr) == cosigners.Threshold {
+					break
+				}
+				if peer.active && peer.wellBehaved(now) == wellBehaved && peer.backingOff(now) == backingOff {
+					parties_arr = append(parties_arr, byte(peer.config.ID))
+				}
+			}
+		}
+	}
+	parties_arr = append(parties_arr, cosigners.LocalID)
 
 	return parties_arr
 }
 
-func (cosigners *RemoteCosigners) StartSession(req CosignerStartSessionRequest) (CosignerStartSessionResponse, error) {
+// wellBehaved is false for peers that misbehaved repeatedly, until the cooldown passed
+func (peer *remotePeer) wellBehaved(now time.Time) bool {
+	return peer.misbehavior < misbehaviorLimit || now.Sub(peer.lastMisbehavior) >= misbehaviorCooldown
+}
+
+// backingOff returns whether requests to the peer are refused until its backoff elapsed
+func (peer *remotePeer) backingOff(now time.Time) bool {
+	return now.Before(peer.retryAt)
+}
+
+// replied records the outcome of a request to the peer.
+// A failure delays the next request to the peer by its backoff.
+func (peer *remotePeer) replied(ok bool, now time.Time) {
+	if ok {
+		peer.backoff.Reset()
+		peer.retryAt = time.Time{}
+		return
+	}
+	peer.retryAt = now.Add(peer.backoff.Next())
+}
+
+// sessionPeers returns the peers among the parties of a session
+func (cosigners *RemoteCosigners) sessionPeers(partyIDs []byte) []byte {
+	peers := make([]byte, 0, len(partyIDs))
+	for _, id := range partyIDs {
+		if id != cosigners.LocalID {
+			peers = append(peers, id)
+		}
+	}
+	return peers
+}
+
+// activePeers returns the IDs of the active peers
+func (cosigners *RemoteCosigners) activePeers() []byte {
+	cosigners.mtx.Lock()
+	defer cosigners.mtx.Unlock()
+	peers := make([]byte, 0, len(cosigners.peers))
+	for _, peer := range cosigners.peers {
+		if peer.active {
+			peers = append(peers, byte(peer.config.ID))
+		}
+	}
+	return peers
+}
+
+// StartSession asks the peers of the session for their first round messages.
+// The signatures of the peers that signed the sign bytes before are returned in PeerSigs,
+// unverified.
+func (cosigners *RemoteCosigners) StartSession(ctx context.Context, req CosignerStartSessionRequest) (CosignerStartSessionResponse, error) {
 	msgsOut1 := make([][]byte, 0, cosigners.Threshold)
 	res := CosignerStartSessionResponse{}
 	to_send := make([][]byte, 3)
-	to_send[0] = []byte("xx")
-	to_send[0][0] = 0
-	to_send[0][1] = req.ID
+	to_send[0] = requestHeader(ctx, 0, req.ID)
 	to_send[1] = req.SignBytes
 	to_send[2] = req.PartyIDs
 
-	for client := range cosigners.SessionClients {
-		_, err := client.SendMessage(to_send)
-		if err != nil {
-			delete(cosigners.ActiveClients, client)
-		}
-	}
-	polled, err := cosigners.Poller.Poll(cosigners.timeout)
-	if err != nil {
-		return res, err
-	}
+	replies := cosigners.requestAll(cosigners.sessionPeers(req.PartyIDs), to_send, "start_session")
 	var collected = 1
-	for _, item := range polled {
-		if item.Events&zmq.POLLIN != 0 {
-			reply, err := item.Socket.RecvMessageBytes(0)
-			_, ok := cosigners.SessionClients[item.Socket]
-			if err == nil && !bytes.Equal(reply[0], []byte("error")) && ok {
-				if bytes.Equal(reply[0], []byte("signature")) {
-					res.MaybeSig = reply[1]
-				} else {
-					collected += 1
-					msgsOut1 = append(msgsOut1, reply...)
+	for id, reply := range replies {
+		if !bytes.Equal(reply[0], []byte("error")) {
+			if bytes.Equal(reply[0], []byte("signature")) && len(reply) == 2 {
+				if res.PeerSigs == nil {
+					res.PeerSigs = make(map[byte][]byte)
 				}
-			}
-			if err != nil {
-				delete(cosigners.ActiveClients, item.Socket)
+				res.PeerSigs[id] = reply[1]
+			} else if err := checkSenders(id, reply); err != nil {
+				cosigners.RecordMisbehavior(id, "start_session", req.SignBytes, err)
+			} else {
+				collected += 1
+				msgsOut1 = append(msgsOut1, reply...)
 			}
 		}
 	}
 	res.Msg1Out = msgsOut1
-	if len(res.MaybeSig) == 64 {
-		// FIXME: verify sig
-		return res, errors.New("signed before")
-	} else if collected < cosigners.Threshold {
-		return res, errors.New("not enough messages collected")
+	// the threshold of peers and ourselves take part in a round
+	if collected < cosigners.Threshold+1 {
+		return res, &QuorumError{Collected: collected, Required: cosigners.Threshold + 1}
 	}
 	return res, nil
 }
 
-func (cosigners *RemoteCosigners) EndSession(req CosignerEndSessionRequest) (CosignerEndSessionResponse, error) {
-	n := len(cosigners.Clients) + 1
+// EndSession asks the peers of the session for their second round messages.
+// Signatures are returned like by StartSession.
+func (cosigners *RemoteCosigners) EndSession(ctx context.Context, req CosignerEndSessionRequest) (CosignerEndSessionResponse, error) {
+	n := len(req.PartyIDs)
 	msgsOut2 := make([][]byte, 0, n)
 	res := CosignerEndSessionResponse{}
 
-	to_send := make([][]byte, 3, n)
-	to_send[0] = []byte("xx")
-	to_send[0][0] = 1
-	to_send[0][1] = req.ID
+	to_send := make([][]byte, 3, 3+len(req.Msg1Out))
+	to_send[0] = requestHeader(ctx, 1, req.ID)
 	to_send[1] = req.SignBytes
 	to_send[2] = req.PartyIDs
 
 	to_send = append(to_send, req.Msg1Out...)
-	for client := range cosigners.SessionClients {
-		_, err := client.SendMessage(to_send)
-		if err != nil {
-			delete(cosigners.ActiveClients, client)
-		}
-	}
-	polled, err := cosigners.Poller.Poll(cosigners.timeout)
-
-	if err != nil {
-		return res, err
-	}
+	replies := cosigners.requestAll(cosigners.sessionPeers(req.PartyIDs), to_send, "end_session")
 	var collected = 1
-	for _, item := range polled {
-		if item.Events&zmq.POLLIN != 0 {
-			reply, err := item.Socket.RecvMessageBytes(0)
-			_, ok := cosigners.SessionClients[item.Socket]
-			if err == nil && !bytes.Equal(reply[0], []byte("error")) && ok {
-				if bytes.Equal(reply[0], []byte("signature")) {
-					res.MaybeSig = reply[1]
-				} else {
-					collected += 1
-					msgsOut2 = append(msgsOut2, reply...)
+	for id, reply := range replies {
+		if !bytes.Equal(reply[0], []byte("error")) {
+			if bytes.Equal(reply[0], []byte("signature")) && len(reply) == 2 {
+				if res.PeerSigs == nil {
+					res.PeerSigs = make(map[byte][]byte)
 				}
-			}
-			if err != nil {
-				delete(cosigners.ActiveClients, item.Socket)
+				res.PeerSigs[id] = reply[1]
+			} else if err := checkSenders(id, reply); err != nil {
+				cosigners.RecordMisbehavior(id, "end_session", req.SignBytes, err)
+			} else {
+				collected += 1
+				msgsOut2 = append(msgsOut2, reply...)
 			}
 		}
 	}
 	res.Msg2Out = msgsOut2
-	if len(res.MaybeSig) == 64 {
-		// FIXME: verify sig
-		return res, errors.New("signed before")
-	} else if collected < cosigners.Threshold {
-		return res, errors.New("not enough messages collected")
+	// the threshold of peers and ourselves take part in a round
+	if collected < cosigners.Threshold+1 {
+		return res, &QuorumError{Collected: collected, Required: cosigners.Threshold + 1}
 	}
 	return res, nil
 }
 
-func (cosigners *RemoteCosigners) SetSignature(req CosignerSetSignatureRequest) (CosignerSetSignatureResponse, error) {
+// size of the header of a FROST message: its type, sender and recipient
+const frostHeaderSize = 1 + 2*party.ByteSize
+
+// checkSenders checks that the FROST messages in the reply of a peer are well-formed
+// and all sent by the peer, so that the peer cannot have a round fail in the name of another
+func checkSenders(id byte, reply [][]byte) error {
+	for _, data := range reply {
+		var msg messages.Message
+		// the header is read without checking its length
+		if len(data) < frostHeaderSize {
+			return fmt.Errorf("%w: truncated message", ErrUnexpectedReply)
+		}
+		if err := msg.UnmarshalBinary(data); err != nil {
+			return fmt.Errorf("%w: %v", ErrUnexpectedReply, err)
+		}
+		if msg.From() != party.ID(id) {
+			return fmt.Errorf("%w: message of cosigner %d", ErrUnexpectedReply, msg.From())
+		}
+	}
+	return nil
+}
+
+func (cosigners *RemoteCosigners) SetSignature(ctx context.Context, req CosignerSetSignatureRequest) (CosignerSetSignatureResponse, error) {
 	res := CosignerSetSignatureResponse{}
 	to_send := make([][]byte, 3)
-	to_send[0] = []byte("xx")
-	to_send[0][0] = 2
-	to_send[0][1] = req.ID
+	to_send[0] = requestHeader(ctx, 2, req.ID)
 	to_send[1] = req.SignBytes
 	to_send[2] = req.Sig
-	for client := range cosigners.ActiveClients {
-		_, err := client.SendMessage(to_send)
+	cosigners.requestAll(cosigners.activePeers(), to_send, "set_signature")
+	res.ID = req.ID
+	return res, nil
+}
+
+// RequestCommitments asks the peer for n nonce commitments for preprocessed signing of the chain
+func (cosigners *RemoteCosigners) RequestCommitments(ctx context.Context, chainID string, id byte, n int) ([]NonceCommitment, error) {
+	cosigners.mtx.Lock()
+	timeout := cosigners.timeout
+	cosigners.mtx.Unlock()
+
+	to_send := make([][]byte, 3)
+	to_send[0] = requestHeader(ctx, 4, cosigners.LocalID)
+	to_send[1] = []byte(chainID)
+	to_send[2] = []byte(strconv.Itoa(n))
+	reply, err := cosigners.request(id, to_send, timeout)
+	if err != nil {
+		return nil, err
+	}
+	if len(reply) == 0 || !bytes.Equal(reply[0], []byte("commitments")) {
+		return nil, ErrUnexpectedReply
+	}
+	commitments := make([]NonceCommitment, 0, len(reply)-1)
+	for _, data := range reply[1:] {
+		commitment, err := NonceCommitmentFromBytes(data)
 		if err != nil {
-			delete(cosigners.ActiveClients, client)
+			return nil, fmt.Errorf("%w: %v", ErrUnexpectedReply, err)
+		}
+		if commitment.ID != id {
+			return nil, fmt.Errorf("%w: commitment of cosigner %d from cosigner %d", ErrUnexpectedReply, commitment.ID, id)
 		}
+		commitments = append(commitments, commitment)
 	}
-	polled, _ := cosigners.Poller.Poll(cosigners.timeout)
+	return commitments, nil
+}
 
-	for _, item := range polled {
-		if item.Events&zmq.POLLIN != 0 {
-			_, err := item.Socket.RecvMessageBytes(0)
+// SignPreprocessed asks the peers for their signature shares over the commitments of the request.
+// Only the peers that replied are in the result.
+func (cosigners *RemoteCosigners) SignPreprocessed(ctx context.Context, ids []byte, req CosignerSignRequest) map[byte]CosignerSignResponse {
+	to_send := make([][]byte, 2, 2+len(req.Commitments))
+	to_send[0] = requestHeader(ctx, 5, req.ID)
+	to_send[1] = req.SignBytes
+	to_send = append(to_send, req.Commitments...)
+
+	replies := cosigners.requestAll(ids, to_send, "sign")
+	responses := make(map[byte]CosignerSignResponse, len(replies))
+	for id, reply := range replies {
+		if len(reply) < 2 {
+			continue
+		}
+		switch {
+		case bytes.Equal(reply[0], []byte("share")):
+			responses[id] = CosignerSignResponse{Share: reply[1]}
+		case bytes.Equal(reply[0], []byte("signature")):
+			responses[id] = CosignerSignResponse{MaybeSig: reply[1]}
+		}
+	}
+	return responses
+}
 
-			if err != nil {
-				delete(cosigners.ActiveClients, item.Socket)
+// requestAll sends the message to each of the peers concurrently and waits until
+// every one of them replied or the timeout elapsed. Peers that fail to reply are
+// no longer active. The reply latency and timeouts of every peer are recorded in the metrics.
+func (cosigners *RemoteCosigners) requestAll(ids []byte, to_send [][]byte, request string) map[byte][][]byte {
+	type reply struct {
+		id  byte
+		msg [][]byte
+		err error
+	}
+	cosigners.mtx.Lock()
+	timeout := cosigners.timeout
+	cosigners.mtx.Unlock()
+
+	sent := time.Now()
+	results := make(chan reply, len(ids))
+	for _, id := range ids {
+		go func(id byte) {
+			msg, err := cosigners.request(id, to_send, timeout)
+			results <- reply{id, msg, err}
+		}(id)
+	}
+
+	replies := make(map[byte][][]byte, len(ids))
+	for range ids {
+		r := <-results
+		cosigners.mtx.Lock()
+		peer := cosigners.peer(r.id)
+		if r.err != nil || len(r.msg) == 0 {
+			if peer != nil {
+				peer.active = false
+			}
+			cosigners.mtx.Unlock()
+			if !errors.Is(r.err, errBackingOff) && !errors.Is(r.err, ErrShuttingDown) {
+				metricPeerTimeouts.WithLabelValues(peerLabel(r.id), request).Inc()
 			}
+			continue
+		}
+		latency := time.Since(sent)
+		if peer != nil {
+			peer.lastReply = time.Now()
+			peer.latencies[request] = latency
 		}
+		cosigners.mtx.Unlock()
+		metricPeerReplyDuration.WithLabelValues(peerLabel(r.id), request).Observe(latency.Seconds())
+		replies[r.id] = r.msg
 	}
-	res.ID = req.ID
-	return res, nil
+	return replies
+}
+
+// SetFaultInjector sets the faults injected into the requests to the peers.
+// It must be called before the first request.
+func (cosigners *RemoteCosigners) SetFaultInjector(faults *FaultInjector) {
+	cosigners.faults = faults
+}
+
+// request sends the message to the peer on a pooled socket and waits for the reply
+func (cosigners *RemoteCosigners) request(id byte, to_send [][]byte, timeout time.Duration) ([][]byte, error) {
+	deadline := time.Now().Add(timeout)
+	fault := cosigners.faults.peerFault(id)
+	if fault.dropsRequest() {
+		if !sleep(cosigners.ctx, timeout) {
+			return nil, ErrShuttingDown
+		}
+		return nil, ErrTimeout
+	}
+	socket, generation, err := cosigners.acquire(id)
+	if err != nil {
+		return nil, err
+	}
+	ok := false
+	defer func() {
+		cosigners.release(id, socket, generation, ok)
+	}()
+	if _, err = socket.SendMessage(to_send); err != nil {
+		return nil, err
+	}
+	if err = waitForReply(cosigners.ctx, socket, timeout); err != nil {
+		return nil, err
+	}
+	reply, err := socket.RecvMessageBytes(0)
+	if err != nil {
+		return nil, err
+	}
+	ok = true
+	return fault.reply(cosigners.ctx, reply, deadline)
+}
+
+// waitForReply polls the socket until a reply arrived, the timeout elapsed or the cosigners were stopped
+func waitForReply(ctx context.Context, socket *zmq.Socket, timeout time.Duration) error {
+	poller := zmq.NewPoller()
+	poller.Add(socket, zmq.POLLIN)
+	deadline := time.Now().Add(timeout)
+	for {
+		wait := time.Until(deadline)
+		if wait <= 0 {
+			return ErrTimeout
+		}
+		if wait > peerPollInterval {
+			wait = peerPollInterval
+		}
+		polled, err := poller.Poll(wait)
+		if err != nil {
+			return err
+		}
+		if len(polled) > 0 {
+			return nil
+		}
+		if ctx.Err() != nil {
+			return ErrShuttingDown
+		}
+	}
+}
+
+// acquire takes an idle socket to the peer from the pool, or connects a new one.
+// Requests to a peer that failed to reply are refused until its backoff elapsed,
+// and all requests are refused once the cosigners are stopped.
+// The socket must be given back with release.
+func (cosigners *RemoteCosigners) acquire(id byte) (*zmq.Socket, int, error) {
+	cosigners.mtx.Lock()
+	defer cosigners.mtx.Unlock()
+	peer := cosigners.peer(id)
+	if peer == nil {
+		return nil, 0, fmt.Errorf("unknown cosigner %d", id)
+	}
+	if now := time.Now(); peer.backingOff(now) {
+		return nil, 0, fmt.Errorf("%w %d for %v", errBackingOff, id, peer.retryAt.Sub(now))
+	}
+	if err := cosigners.begin(); err != nil {
+		return nil, 0, err
+	}
+	if n := len(peer.idle); n > 0 {
+		socket := peer.idle[n-1]
+		peer.idle = peer.idle[:n-1]
+		return socket, peer.generation, nil
+	}
+	socket, err := cosigners.Context.NewSocket(zmq.REQ)
+	if err != nil {
+		cosigners.inflight.Done()
+		return nil, 0, err
+	}
+	// the socket reconnects on its own with the same policy, but without jitter
+	socket.SetReconnectIvl(cosigners.reconnect.initialDelay())
+	socket.SetReconnectIvlMax(cosigners.reconnect.maxDelay())
+	if err = socket.Connect(peer.config.Address); err != nil {
+		socket.Close()
+		cosigners.inflight.Done()
+		return nil, 0, err
+	}
+	return socket, peer.generation, nil
+}
+
+// release puts the socket back in the pool of the peer.
+// A socket whose request failed is stuck waiting for its reply, so it is closed instead,
+// as are sockets of a connection that was reset in the meantime.
+// The failure delays the next request to the peer by its backoff.
+func (cosigners *RemoteCosigners) release(id byte, socket *zmq.Socket, generation int, ok bool) {
+	cosigners.mtx.Lock()
+	defer cosigners.mtx.Unlock()
+	defer cosigners.inflight.Done()
+	peer := cosigners.peer(id)
+	current := peer != nil && peer.generation == generation
+	if current {
+		peer.replied(ok, time.Now())
+	}
+	if ok && current {
+		peer.idle = append(peer.idle, socket)
+		return
+	}
+	socket.SetLinger(0)
+	socket.Close()
+}
+
+func peerLabel(partyI byte) string {
+	return strconv.Itoa(int(partyI))
 }
@@ -0,0 +1,167 @@
+package signer
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// newTestRemoteCosigners returns the peers of cosigner 1 of a 2-of-3 group, without connecting to them
+func newTestRemoteCosigners(t *testing.T) *RemoteCosigners {
+	t.Helper()
+	cosigners, err := NewRemoteCosigners(CoConfig{
+		CosignerId:        1,
+		CosignerThreshold: 1,
+		SessionTimeoutSec: 1,
+		Cosigners: []CosignerConfig{
+			{ID: 2, Address: "tcp://127.0.0.1:1"},
+			{ID: 3, Address: "tcp://127.0.0.1:1"},
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { cosigners.Context.Term() })
+	return cosigners
+}
+
+func TestPeerRetryGate(t *testing.T) {
+	now := time.Now()
+	cases := []struct {
+		name string
+		// when each peer last failed to reply, if it did
+		failed  map[byte]time.Time
+		parties []byte
+		// peers whose requests are refused
+		refused []byte
+	}{
+		{"all replied", nil, []byte{2, 1}, nil},
+		{"one failed", map[byte]time.Time{2: now}, []byte{3, 1}, []byte{2}},
+		{"backoff elapsed", map[byte]time.Time{2: now.Add(-time.Hour)}, []byte{2, 1}, nil},
+		{"all failed", map[byte]time.Time{2: now, 3: now}, []byte{2, 1}, []byte{2, 3}},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			cosigners := newTestRemoteCosigners(t)
+			for id, at := range c.failed {
+				cosigners.peer(id).replied(false, at)
+			}
+			if parties := cosigners.ResetParties(); !reflect.DeepEqual(parties, c.parties) {
+				t.Errorf("got parties %v, want %v", parties, c.parties)
+			}
+			for _, id := range c.refused {
+				if _, _, err := cosigners.acquire(id); !errors.Is(err, errBackingOff) {
+					t.Errorf("got error %v for cosigner %d, want %v", err, id, errBackingOff)
+				}
+			}
+		})
+	}
+}
+
+func TestPeerRetryGateReset(t *testing.T) {
+	cosigners := newTestRemoteCosigners(t)
+	peer := cosigners.peer(2)
+	peer.replied(false, time.Now())
+	peer.replied(false, time.Now())
+	peer.replied(true, time.Now())
+	if peer.backingOff(time.Now()) {
+		t.Error("backing off after a reply")
+	}
+	// the backoff starts over after a reply
+	peer.replied(false, time.Now())
+	if wait := time.Until(peer.retryAt); wait > defaultReconnectInitial {
+		t.Errorf("backing off for %v after the first failure, want at most %v", wait, defaultReconnectInitial)
+	}
+}
+
+func TestPeerMisbehavior(t *testing.T) {
+	now := time.Now()
+	type misbehavior struct {
+		count int
+		last  time.Time
+	}
+	cases := []struct {
+		name        string
+		misbehavior map[byte]misbehavior
+		succeeded   []byte
+		parties     []byte
+	}{
+		{"well-behaved", nil, nil, []byte{2, 1}},
+		{"below the limit", map[byte]misbehavior{2: {misbehaviorLimit - 1, now}}, nil, []byte{2, 1}},
+		{"repeat offender", map[byte]misbehavior{2: {misbehaviorLimit, now}}, nil, []byte{3, 1}},
+		{"cooldown passed", map[byte]misbehavior{2: {misbehaviorLimit, now.Add(-misbehaviorCooldown)}}, nil, []byte{2, 1}},
+		{"good round", map[byte]misbehavior{2: {misbehaviorLimit, now}}, []byte{2}, []byte{2, 1}},
+		{"only repeat offenders", map[byte]misbehavior{2: {misbehaviorLimit, now}, 3: {misbehaviorLimit, now}}, nil, []byte{2, 1}},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			cosigners := newTestRemoteCosigners(t)
+			for id, m := range c.misbehavior {
+				peer := cosigners.peer(id)
+				peer.misbehavior, peer.lastMisbehavior = m.count, m.last
+			}
+			cosigners.RecordSuccess(c.succeeded)
+			if parties := cosigners.ResetParties(); !reflect.DeepEqual(parties, c.parties) {
+				t.Errorf("got parties %v, want %v", parties, c.parties)
+			}
+		})
+	}
+}
+
+func TestCheckSenders(t *testing.T) {
+	cosigners := newTestCosigners(t, 3, 1)
+	ctx := context.Background()
+	msgs := make(map[byte][][]byte)
+	for _, id := range []byte{2, 3} {
+		req := CosignerStartSessionRequest{ID: 1, PartyIDs: []byte{1, id}, SignBytes: testVote(1, "a", time.Now())}
+		res, err := cosigners[id-1].StartSession(ctx, req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		msgs[id] = res.Msg1Out
+	}
+	cases := []struct {
+		name  string
+		reply [][]byte
+		valid bool
+	}{
+		{"messages of the peer", msgs[2], true},
+		{"messages of another cosigner", msgs[3], false},
+		{"messages of the peer and another cosigner", append(append([][]byte(nil), msgs[2]...), msgs[3]...), false},
+		{"truncated", [][]byte{msgs[2][0][:frostHeaderSize-1]}, false},
+		{"garbage", [][]byte{bytes.Repeat([]byte{0xff}, 64)}, false},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			err := checkSenders(2, c.reply)
+			if c.valid && err != nil {
+				t.Errorf("got error %v", err)
+			}
+			if !c.valid && !errors.Is(err, ErrUnexpectedReply) {
+				t.Errorf("got error %v, want %v", err, ErrUnexpectedReply)
+			}
+		})
+	}
+}
+
+func TestSessionQuorum(t *testing.T) {
+	cosigners := newTestRemoteCosigners(t)
+	// the only peer of the session does not reply, so we are the only party left
+	cosigners.peer(2).replied(false, time.Now())
+	ctx := context.Background()
+	signBytes := testVote(1, "a", time.Now())
+	want := QuorumError{Collected: 1, Required: 2}
+
+	_, err := cosigners.StartSession(ctx, CosignerStartSessionRequest{ID: 1, PartyIDs: []byte{1, 2}, SignBytes: signBytes})
+	var quorumErr *QuorumError
+	if !errors.As(err, &quorumErr) || *quorumErr != want {
+		t.Errorf("start session: got error %v, want %v", err, &want)
+	}
+	_, err = cosigners.EndSession(ctx, CosignerEndSessionRequest{ID: 1, PartyIDs: []byte{1, 2}, SignBytes: signBytes})
+	if !errors.As(err, &quorumErr) || *quorumErr != want {
+		t.Errorf("end session: got error %v, want %v", err, &want)
+	}
+}
@@ -3,7 +3,6 @@
 package signer
 
 import (
-	"errors"
 	"io"
 
 	"github.com/tendermint/tendermint/libs/protoio"
@@ -26,11 +25,12 @@ func WriteMsg(writer io.Writer, msg tmProtoPrivval.Message) (err error) {
 	return err
 }
 
-// UnpackHRS deserializes sign bytes and gets the height, round, and step
+// UnpackHRS deserializes sign bytes and gets the height, round, and step.
+// Sign bytes that are not a canonical proposal or vote are refused with ErrInvalidSignBytes.
 func UnpackHRS(signBytes []byte) (height int64, round int64, step int8, chainId string, err error) {
 	{
 		var proposal tmProto.CanonicalProposal
-		if err := protoio.UnmarshalDelimited(signBytes, &proposal); err == nil {
+		if err := protoio.UnmarshalDelimited(signBytes, &proposal); err == nil && proposal.Type == tmProto.ProposalType {
 			return proposal.Height, proposal.Round, stepPropose, proposal.ChainID, nil
 		}
 	}
@@ -38,9 +38,12 @@ func UnpackHRS(signBytes []byte) (height int64, round int64, step int8, chainId
 	{
 		var vote tmProto.CanonicalVote
 		if err := protoio.UnmarshalDelimited(signBytes, &vote); err == nil {
-			return vote.Height, vote.Round, CanonicalVoteToStep(&vote), vote.ChainID, nil
+			switch vote.Type {
+			case tmProto.PrevoteType, tmProto.PrecommitType:
+				return vote.Height, vote.Round, CanonicalVoteToStep(&vote), vote.ChainID, nil
+			}
 		}
 	}
 
-	return 0, 0, 0, "", errors.New("could not UnpackHRS from sign bytes")
+	return 0, 0, 0, "", ErrInvalidSignBytes
 }
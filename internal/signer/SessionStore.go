@@ -0,0 +1,164 @@
+package signer
+
+import (
+	"time"
+)
+
+const (
+	// most signing sessions a cosigner holds for a chain
+	maxSessions = 512
+	// most signing sessions a cosigner holds for a chain on behalf of one coordinator,
+	// so that a peer opening sessions it never finishes cannot take up all of them
+	maxSessionsPerCoordinator = 64
+	// how many heights above the reference height (see LocalCosigner.referenceHeight)
+	// peers may open sessions at
+	maxSessionLookahead = 100
+	// how often the expired sessions are reaped
+	sessionReapInterval = time.Second
+)
+
+// SessionStore holds the signing sessions of a cosigner by HRS, coordinator and party set.
+// It holds at most maxSessions sessions, and maxSessionsPerCoordinator sessions of
+// each coordinator. It is not safe for concurrent use.
+//
+// A session whose share was released for sign bytes must be kept until a signature for
+// its HRS or a later one is recorded, even if it expired: it is the only record that the
+// HRS must not be signed with other sign bytes. Other sessions may be dropped at any time,
+// which only makes the rounds they belong to fail.
+type SessionStore struct {
+	sessions map[HRSKey]map[SortedPartyIds]HRSMeta
+	count    int
+	// number of sessions of each coordinator
+	coordinators map[byte]int
+}
+
+func NewSessionStore() *SessionStore {
+	return &SessionStore{
+		sessions:     make(map[HRSKey]map[SortedPartyIds]HRSMeta),
+		coordinators: make(map[byte]int),
+	}
+}
+
+// Len returns the number of sessions in the store
+func (store *SessionStore) Len() int {
+	return store.count
+}
+
+// Get returns the session of the party set at the HRS
+func (store *SessionStore) Get(hrsKey HRSKey, partyKey SortedPartyIds) (HRSMeta, bool) {
+	session, ok := store.sessions[hrsKey][partyKey]
+	return session, ok
+}
+
+// Any returns one of the sessions at the HRS; they all have the same sign bytes but for the timestamp
+func (store *SessionStore) Any(hrsKey HRSKey) (HRSMeta, bool) {
+	for _, session := range store.sessions[hrsKey] {
+		return session, true
+	}
+	return HRSMeta{}, false
+}
+
+// Put adds or replaces the session of the party set at the HRS.
+// A session replacing a released one is released as well.
+// A new session is refused with ErrTooManySessions if the store, or the share of the
+// store of its coordinator, is full even after dropping the expired sessions.
+func (store *SessionStore) Put(hrsKey HRSKey, partyKey SortedPartyIds, session HRSMeta, watermark HRSKey) error {
+	sessions, ok := store.sessions[hrsKey]
+	if existing, exists := sessions[partyKey]; exists {
+		session.released = session.released || existing.released
+	} else {
+		if store.full(partyKey.Coordinator) {
+			store.Reap(time.Now(), watermark)
+		}
+		if store.full(partyKey.Coordinator) {
+			return ErrTooManySessions
+		}
+		store.count++
+		store.coordinators[partyKey.Coordinator]++
+	}
+	if !ok {
+		sessions = make(map[SortedPartyIds]HRSMeta)
+		store.sessions[hrsKey] = sessions
+	}
+	sessions[partyKey] = session
+	return nil
+}
+
+// full returns whether no session of the coordinator may be added
+func (store *SessionStore) full(coordinator byte) bool {
+	return store.count >= maxSessions || store.coordinators[coordinator] >= maxSessionsPerCoordinator
+}
+
+// remove accounts for the removal of a session of the coordinator
+func (store *SessionStore) remove(coordinator byte) {
+	store.count--
+	if store.coordinators[coordinator]--; store.coordinators[coordinator] == 0 {
+		delete(store.coordinators, coordinator)
+	}
+}
+
+// Delete removes the session of the party set at the HRS.
+// A released session only loses its state: it keeps recording its sign bytes.
+func (store *SessionStore) Delete(hrsKey HRSKey, partyKey SortedPartyIds) {
+	sessions := store.sessions[hrsKey]
+	session, exists := sessions[partyKey]
+	if !exists {
+		return
+	}
+	if session.released {
+		sessions[partyKey] = HRSMeta{
+			currentSignBytes: session.currentSignBytes,
+			expirationTime:   session.expirationTime,
+			released:         true,
+		}
+		return
+	}
+	delete(sessions, partyKey)
+	store.remove(partyKey.Coordinator)
+	if len(sessions) == 0 {
+		delete(store.sessions, hrsKey)
+	}
+}
+
+// DropBelow removes the sessions below the HRS of a new signature, except those that
+// released our share and have not expired yet: they can only produce the signature
+// they were started for, so they may still finish.
+func (store *SessionStore) DropBelow(hrsKey HRSKey, now time.Time) {
+	store.drop(func(existingKey HRSKey, session HRSMeta) bool {
+		return existingKey.Less(hrsKey) && (!session.released || session.expirationTime.Before(now))
+	})
+}
+
+// Reap removes the expired sessions, except those above the watermark that released
+// our share, and returns how many were removed
+func (store *SessionStore) Reap(now time.Time, watermark HRSKey) int {
+	return store.drop(func(existingKey HRSKey, session HRSMeta) bool {
+		return session.expirationTime.Before(now) && (!session.released || !watermark.Less(existingKey))
+	})
+}
+
+func (store *SessionStore) drop(match func(HRSKey, HRSMeta) bool) int {
+	dropped := 0
+	for existingKey, sessions := range store.sessions {
+		for partyKey, session := range sessions {
+			if match(existingKey, session) {
+				delete(sessions, partyKey)
+				store.remove(partyKey.Coordinator)
+				dropped++
+			}
+		}
+		if len(sessions) == 0 {
+			delete(store.sessions, existingKey)
+		}
+	}
+	return dropped
+}
+
+// Each calls f for every session in the store
+func (store *SessionStore) Each(f func(HRSKey, SortedPartyIds, HRSMeta)) {
+	for hrsKey, sessions := range store.sessions {
+		for partyKey, session := range sessions {
+			f(hrsKey, partyKey, session)
+		}
+	}
+}
@@ -0,0 +1,204 @@
+package signer
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+)
+
+func sessionKey(coordinator byte, n int) SortedPartyIds {
+	return SortedPartyIds{Coordinator: coordinator, Ids: fmt.Sprint(n)}
+}
+
+func TestSessionStorePut(t *testing.T) {
+	now := time.Now()
+	live := HRSMeta{expirationTime: now.Add(time.Minute)}
+	expired := HRSMeta{expirationTime: now.Add(-time.Minute)}
+	releasedExpired := HRSMeta{expirationTime: now.Add(-time.Minute), released: true}
+	watermark := HRSKey{Height: 1}
+
+	// fill puts n sessions of the coordinator at heights above the watermark
+	fill := func(store *SessionStore, coordinator byte, n int, session HRSMeta) {
+		for i := 0; i < n; i++ {
+			hrsKey := HRSKey{Height: int64(10 + i)}
+			if err := store.Put(hrsKey, sessionKey(coordinator, 0), session, watermark); err != nil {
+				t.Fatalf("filling: %v", err)
+			}
+		}
+	}
+	fillAll := func(store *SessionStore, session HRSMeta) {
+		for coordinator := byte(1); coordinator <= maxSessions/maxSessionsPerCoordinator; coordinator++ {
+			fill(store, coordinator, maxSessionsPerCoordinator, session)
+		}
+	}
+
+	cases := []struct {
+		name        string
+		setup       func(*SessionStore)
+		coordinator byte
+		err         error
+		len         int
+	}{
+		{
+			name:        "empty",
+			setup:       func(*SessionStore) {},
+			coordinator: 1,
+			len:         1,
+		},
+		{
+			name: "replaces the session of the key",
+			setup: func(store *SessionStore) {
+				store.Put(HRSKey{Height: 2}, sessionKey(1, 0), live, watermark)
+			},
+			coordinator: 1,
+			len:         1,
+		},
+		{
+			name:        "store full",
+			setup:       func(store *SessionStore) { fillAll(store, live) },
+			coordinator: 100,
+			err:         ErrTooManySessions,
+			len:         maxSessions,
+		},
+		{
+			name:        "store full of expired sessions",
+			setup:       func(store *SessionStore) { fillAll(store, expired) },
+			coordinator: 100,
+			len:         1,
+		},
+		{
+			name:        "store full of expired released sessions above the watermark",
+			setup:       func(store *SessionStore) { fillAll(store, releasedExpired) },
+			coordinator: 100,
+			err:         ErrTooManySessions,
+			len:         maxSessions,
+		},
+		{
+			name:        "coordinator full",
+			setup:       func(store *SessionStore) { fill(store, 1, maxSessionsPerCoordinator, live) },
+			coordinator: 1,
+			err:         ErrTooManySessions,
+			len:         maxSessionsPerCoordinator,
+		},
+		{
+			name:        "coordinator full of expired released sessions above the watermark",
+			setup:       func(store *SessionStore) { fill(store, 1, maxSessionsPerCoordinator, releasedExpired) },
+			coordinator: 1,
+			err:         ErrTooManySessions,
+			len:         maxSessionsPerCoordinator,
+		},
+		{
+			name:        "another coordinator full",
+			setup:       func(store *SessionStore) { fill(store, 1, maxSessionsPerCoordinator, releasedExpired) },
+			coordinator: 2,
+			len:         maxSessionsPerCoordinator + 1,
+		},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			store := NewSessionStore()
+			c.setup(store)
+			err := store.Put(HRSKey{Height: 2}, sessionKey(c.coordinator, 0), live, watermark)
+			if !errors.Is(err, c.err) {
+				t.Errorf("got error %v, want %v", err, c.err)
+			}
+			if store.Len() != c.len {
+				t.Errorf("got %d sessions, want %d", store.Len(), c.len)
+			}
+		})
+	}
+}
+
+func TestSessionStoreReap(t *testing.T) {
+	now := time.Now()
+	watermark := HRSKey{Height: 5, Round: 0, Step: stepPrevote}
+	cases := []struct {
+		name    string
+		hrsKey  HRSKey
+		session HRSMeta
+		dropped bool
+	}{
+		{"live", HRSKey{Height: 6}, HRSMeta{expirationTime: now.Add(time.Second)}, false},
+		{"expired", HRSKey{Height: 6}, HRSMeta{expirationTime: now.Add(-time.Second)}, true},
+		{"live released", HRSKey{Height: 6}, HRSMeta{expirationTime: now.Add(time.Second), released: true}, false},
+		{"expired released above the watermark", HRSKey{Height: 5, Step: stepPrecommit}, HRSMeta{expirationTime: now.Add(-time.Second), released: true}, false},
+		{"expired released at the watermark", watermark, HRSMeta{expirationTime: now.Add(-time.Second), released: true}, true},
+		{"expired released below the watermark", HRSKey{Height: 4}, HRSMeta{expirationTime: now.Add(-time.Second), released: true}, true},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			store := NewSessionStore()
+			if err := store.Put(c.hrsKey, sessionKey(1, 0), c.session, watermark); err != nil {
+				t.Fatal(err)
+			}
+			n := store.Reap(now, watermark)
+			_, kept := store.Get(c.hrsKey, sessionKey(1, 0))
+			if kept == c.dropped || (n == 1) != c.dropped || store.Len() != 1-n {
+				t.Errorf("reaped %d sessions, kept: %v, %d left", n, kept, store.Len())
+			}
+		})
+	}
+}
+
+func TestSessionStoreDropBelow(t *testing.T) {
+	now := time.Now()
+	signed := HRSKey{Height: 5, Round: 1, Step: stepPrevote}
+	cases := []struct {
+		name    string
+		hrsKey  HRSKey
+		session HRSMeta
+		dropped bool
+	}{
+		{"below", HRSKey{Height: 5, Round: 0}, HRSMeta{expirationTime: now.Add(time.Second)}, true},
+		{"below released", HRSKey{Height: 5, Round: 0}, HRSMeta{expirationTime: now.Add(time.Second), released: true}, false},
+		{"below released expired", HRSKey{Height: 4}, HRSMeta{expirationTime: now.Add(-time.Second), released: true}, true},
+		{"at the signature", signed, HRSMeta{expirationTime: now.Add(-time.Second)}, false},
+		{"above", HRSKey{Height: 6}, HRSMeta{expirationTime: now.Add(-time.Second)}, false},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			store := NewSessionStore()
+			if err := store.Put(c.hrsKey, sessionKey(1, 0), c.session, HRSKey{}); err != nil {
+				t.Fatal(err)
+			}
+			store.DropBelow(signed, now)
+			_, kept := store.Get(c.hrsKey, sessionKey(1, 0))
+			if kept == c.dropped {
+				t.Errorf("kept: %v, want dropped: %v", kept, c.dropped)
+			}
+			if store.Len() != len(store.coordinators) {
+				t.Errorf("%d sessions but %d coordinators counted", store.Len(), len(store.coordinators))
+			}
+		})
+	}
+}
+
+func TestSessionStoreKeepsReleased(t *testing.T) {
+	now := time.Now()
+	hrsKey := HRSKey{Height: 6}
+	released := HRSMeta{expirationTime: now.Add(-time.Second), released: true}
+	cases := []struct {
+		name   string
+		change func(*SessionStore)
+	}{
+		{"replaced", func(store *SessionStore) {
+			store.Put(hrsKey, sessionKey(1, 0), HRSMeta{expirationTime: now.Add(-time.Second)}, HRSKey{})
+		}},
+		{"deleted", func(store *SessionStore) { store.Delete(hrsKey, sessionKey(1, 0)) }},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			store := NewSessionStore()
+			if err := store.Put(hrsKey, sessionKey(1, 0), released, HRSKey{}); err != nil {
+				t.Fatal(err)
+			}
+			c.change(store)
+			store.Reap(now, HRSKey{Height: 5})
+			session, kept := store.Get(hrsKey, sessionKey(1, 0))
+			if !kept || !session.released {
+				t.Errorf("kept: %v, released: %v", kept, session.released)
+			}
+		})
+	}
+}
@@ -35,14 +35,15 @@ func CanonicalVoteToStep(vote *tmProto.CanonicalVote) int8 {
 	}
 }
 
-func VoteToStep(vote *tmProto.Vote) int8 {
+// VoteToStep returns the step of the vote, or an error wrapping ErrInvalidRequest for an unknown vote type
+func VoteToStep(vote *tmProto.Vote) (int8, error) {
 	switch vote.Type {
 	case tmProto.PrevoteType:
-		return stepPrevote
+		return stepPrevote, nil
 	case tmProto.PrecommitType:
-		return stepPrecommit
+		return stepPrecommit, nil
 	default:
-		panic("Unknown vote type")
+		return 0, fmt.Errorf("%w: unknown vote type %v", ErrInvalidRequest, vote.Type)
 	}
 }
 
@@ -59,22 +60,36 @@ type SignState struct {
 	SignBytes tmBytes.HexBytes `json:"signbytes,omitempty"`
 
 	filePath string
+	// set for the sign states of dry-run cosigners, which are never saved
+	inMemory bool
+}
+
+// NewMemorySignState returns an empty sign state that is not persisted
+func NewMemorySignState() SignState {
+	return SignState{inMemory: true}
 }
 
 // Save persists the FilePvLastSignState to its filePath.
 func (signState *SignState) Save() {
+	if err := signState.write(); err != nil {
+		panic(err)
+	}
+}
+
+// write persists the sign state like Save, returning the error instead of panicking
+func (signState *SignState) write() error {
+	if signState.inMemory {
+		return nil
+	}
 	outFile := signState.filePath
 	if outFile == "" {
-		panic("cannot save SignState: filePath not set")
+		return errors.New("cannot save SignState: filePath not set")
 	}
 	jsonBytes, err := tmJson.MarshalIndent(signState, "", "  ")
 	if err != nil {
-		panic(err)
-	}
-	err = tempfile.WriteFileAtomic(outFile, jsonBytes, 0600)
-	if err != nil {
-		panic(err)
+		return err
 	}
+	return tempfile.WriteFileAtomic(outFile, jsonBytes, 0600)
 }
 
 // CheckHRS checks the given height, round, step (HRS) against that of the
@@ -84,18 +99,26 @@ func (signState *SignState) Save() {
 // we have already signed for this HRS, and can reuse the existing signature).
 // It panics if the HRS matches the arguments, there's a SignBytes, but no Signature.
 func (signState *SignState) CheckHRS(height int64, round int64, step int8) (bool, error) {
+	regression := &RegressionError{
+		Height:     height,
+		Round:      round,
+		Step:       step,
+		LastHeight: signState.Height,
+		LastRound:  signState.Round,
+		LastStep:   signState.Step,
+	}
 	if signState.Height > height {
-		return false, fmt.Errorf("height regression. Got %v, last height %v", height, signState.Height)
+		return false, regression
 	}
 
 	if signState.Height == height {
 		if signState.Round > round {
-			return false, fmt.Errorf("round regression at height %v. Got %v, last round %v", height, round, signState.Round)
+			return false, regression
 		}
 
 		if signState.Round == round {
 			if signState.Step > step {
-				return false, fmt.Errorf("step regression at height %v round %v. Got %v, last step %v", height, round, step, signState.Step)
+				return false, regression
 			} else if signState.Step == step {
 				if signState.SignBytes != nil {
 					if signState.Signature == nil {
@@ -103,7 +126,7 @@ func (signState *SignState) CheckHRS(height int64, round int64, step int8) (bool
 					}
 					return true, nil
 				}
-				return false, errors.New("no SignBytes found")
+				return false, ErrNoSignBytes
 			}
 		}
 	}
@@ -149,6 +172,8 @@ func (signState *SignState) OnlyDifferByTimestamp(signBytes []byte) (time.Time,
 	return CheckOnlyDifferByTimestamp(signState.Step, signState.SignBytes, signBytes)
 }
 
+// CheckOnlyDifferByTimestamp returns whether the sign bytes of the step are the same but for the timestamp,
+// and the timestamp of the last sign bytes. Sign bytes that do not unmarshal never match.
 func CheckOnlyDifferByTimestamp(step int8, lastSignBytes []byte, newSignBytes []byte) (time.Time, bool) {
 	if step == stepPropose {
 		return checkProposalOnlyDifferByTimestamp(lastSignBytes, newSignBytes)
@@ -162,10 +187,10 @@ func CheckOnlyDifferByTimestamp(step int8, lastSignBytes []byte, newSignBytes []
 func checkVoteOnlyDifferByTimestamp(lastSignBytes, newSignBytes []byte) (time.Time, bool) {
 	var lastVote, newVote tmProto.CanonicalVote
 	if err := protoio.UnmarshalDelimited(lastSignBytes, &lastVote); err != nil {
-		panic(fmt.Sprintf("LastSignBytes cannot be unmarshalled into vote: %v", err))
+		return time.Time{}, false
 	}
 	if err := protoio.UnmarshalDelimited(newSignBytes, &newVote); err != nil {
-		panic(fmt.Sprintf("signBytes cannot be unmarshalled into vote: %v", err))
+		return time.Time{}, false
 	}
 
 	lastTime := lastVote.Timestamp
@@ -181,10 +206,10 @@ func checkVoteOnlyDifferByTimestamp(lastSignBytes, newSignBytes []byte) (time.Ti
 func checkProposalOnlyDifferByTimestamp(lastSignBytes, newSignBytes []byte) (time.Time, bool) {
 	var lastProposal, newProposal tmProto.CanonicalProposal
 	if err := protoio.UnmarshalDelimited(lastSignBytes, &lastProposal); err != nil {
-		panic(fmt.Sprintf("LastSignBytes cannot be unmarshalled into proposal: %v", err))
+		return time.Time{}, false
 	}
 	if err := protoio.UnmarshalDelimited(newSignBytes, &newProposal); err != nil {
-		panic(fmt.Sprintf("signBytes cannot be unmarshalled into proposal: %v", err))
+		return time.Time{}, false
 	}
 
 	lastTime := lastProposal.Timestamp
@@ -3,25 +3,52 @@
 package signer
 
 import (
+	"context"
 	"fmt"
+	"sort"
+	"strings"
+	"time"
 
+	"github.com/taurusgroup/frost-ed25519/pkg/frost/party"
 	tmlog "github.com/tendermint/tendermint/libs/log"
 
 	zmq "github.com/pebbe/zmq4"
 	tmService "github.com/tendermint/tendermint/libs/service"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
 )
 
 // SignerServer listens on zmq and responds to any
 // signature requests its socket.
+// Requests are routed to the local cosigner of the chain
+// given by the chain ID in their sign bytes.
 type SignerServer struct {
 	tmService.BaseService
 	Context *zmq.Context
 	Server  *zmq.Socket
-	Local   *LocalCosigner
+	Locals  map[string]*LocalCosigner
+
+	// closed by the loop once it has closed the socket
+	done chan struct{}
 }
 
-// NewSignerServer instantiates a local cosigner with the specified key and sign state
-func NewSignerServer(logger tmlog.Logger, local *LocalCosigner, config CoConfig) (*SignerServer, error) {
+// how often the loop checks whether the server was stopped while no request arrives
+const serverPollInterval = 100 * time.Millisecond
+
+// how long OnStop waits for the request being handled
+const serverStopTimeout = 5 * time.Second
+
+// NewSignerServer instantiates a server for the local cosigners of all configured chains.
+// Each chain also gets a dry-run cosigner serving the test signatures of the chain.
+func NewSignerServer(logger tmlog.Logger, locals []*LocalCosigner, config CoConfig) (*SignerServer, error) {
+	localsByChain := make(map[string]*LocalCosigner, 2*len(locals))
+	for _, local := range locals {
+		if _, ok := localsByChain[local.ChainID()]; ok {
+			return nil, fmt.Errorf("duplicate chain ID %q", local.ChainID())
+		}
+		localsByChain[local.ChainID()] = local
+		localsByChain[TestSignChainID(local.ChainID())] = local.DryRun()
+	}
 	context, err := zmq.NewContext()
 	if err != nil {
 		return nil, err
@@ -37,7 +64,7 @@ func NewSignerServer(logger tmlog.Logger, local *LocalCosigner, config CoConfig)
 	cosignerServer := &SignerServer{
 		Context: context,
 		Server:  server,
-		Local:   local,
+		Locals:  localsByChain,
 	}
 
 	cosignerServer.BaseService = *tmService.NewBaseService(logger, "SignerServer", cosignerServer)
@@ -47,27 +74,187 @@ func NewSignerServer(logger tmlog.Logger, local *LocalCosigner, config CoConfig)
 // OnStart implements cmn.Service.
 func (rs *SignerServer) OnStart() error {
 	rs.BaseService.OnStart()
+	rs.done = make(chan struct{})
 	go rs.loop()
+	go rs.reapSessions()
 	return nil
 }
 
 // OnStop implements cmn.Service.
+// The request being handled is answered before the socket is closed.
 func (rs *SignerServer) OnStop() {
 	rs.BaseService.OnStop()
-	rs.Server.SetLinger(0)
-	rs.Server.Close()
-	rs.Context.Term()
+	if rs.done == nil {
+		// never started: the socket is not owned by the loop
+		rs.Server.SetLinger(0)
+		rs.Server.Close()
+	} else {
+		select {
+		case <-rs.done:
+		case <-time.After(serverStopTimeout):
+			// terminating the context would block on the socket still in use
+			rs.Logger.Error("Request handler did not stop", "timeout", serverStopTimeout)
+			return
+		}
+	}
+	if err := rs.Context.Term(); err != nil {
+		rs.Logger.Error("Terminating context", "err", err)
+	}
+}
+
+// localFor returns the local cosigner of the chain the request is for,
+// if the request is from a peer holding a key share
+func (rs *SignerServer) localFor(req CosignerRequest) (*LocalCosigner, error) {
+	var chainId string
+	if commitmentsReq, ok := req.(CosignerCommitmentsRequest); ok {
+		chainId = commitmentsReq.ChainID
+	} else {
+		var err error
+		if _, _, _, chainId, err = UnpackHRS(req.GetSignBytes()); err != nil {
+			return nil, err
+		}
+	}
+	local, ok := rs.Locals[chainId]
+	if !ok {
+		return nil, &ChainIDError{ChainID: chainId}
+	}
+	// our own requests are trusted further, see LocalCosigner.checkLookahead
+	if party.ID(req.PartyId()) == local.kgOutput.Secret.ID {
+		return nil, fmt.Errorf("%w: request from a peer with our own ID", ErrInvalidSession)
+	}
+	if !local.kgOutput.Shares.PartySet.Contains(party.ID(req.PartyId())) {
+		return nil, fmt.Errorf("%w: request from cosigner %d without a key share", ErrInvalidSession, req.PartyId())
+	}
+	return local, nil
 }
 
-// main loop for SignerServer
+// reapSessions periodically drops the expired sessions of the local cosigners until the server stops
+func (rs *SignerServer) reapSessions() {
+	ticker := time.NewTicker(sessionReapInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-rs.Quit():
+			return
+		case <-ticker.C:
+			for chainID, local := range rs.Locals {
+				if n := local.ReapSessions(); n > 0 {
+					rs.Logger.Debug("reaped sessions", "chain_id", chainID, "count", n)
+				}
+			}
+		}
+	}
+}
+
+// pong returns the reply to a ping, with the last HRS of each chain
+func (rs *SignerServer) pong() CosignerPongResponse {
+	res := CosignerPongResponse{Version: CosignerProtocolVersion}
+	for chainID, local := range rs.Locals {
+		if strings.HasPrefix(chainID, TestSignChainPrefix) {
+			continue
+		}
+		state := local.SignState()
+		res.Chains = append(res.Chains, ChainHRS{ChainID: chainID, Height: state.Height, Round: state.Round, Step: state.Step})
+	}
+	sort.Slice(res.Chains, func(i, j int) bool { return res.Chains[i].ChainID < res.Chains[j].ChainID })
+	return res
+}
+
+// commitments returns the reply to a request for nonce commitments
+func (rs *SignerServer) commitments(req CosignerCommitmentsRequest) [][]byte {
+	local, err := rs.localFor(req)
+	if err != nil {
+		return [][]byte{[]byte("error"), []byte(fmt.Sprintf("err: %v", err))}
+	}
+	commitments, err := local.Commitments(req.ID, req.Count)
+	if err != nil {
+		return [][]byte{[]byte("error"), []byte(fmt.Sprintf("err: %v", err))}
+	}
+	to_send := make([][]byte, 0, 1+len(commitments))
+	to_send = append(to_send, []byte("commitments"))
+	for i := range commitments {
+		to_send = append(to_send, commitments[i].Bytes())
+	}
+	return to_send
+}
+
+// startSpan starts the span of a handler for a request from a peer.
+// If the peer sent its trace context, the span continues the peer's trace.
+func (rs *SignerServer) startSpan(ctx context.Context, name string, req CosignerRequest) (context.Context, trace.Span) {
+	attributes := []attribute.KeyValue{attribute.Int("peer", int(req.PartyId()))}
+	if height, round, step, chainId, err := UnpackHRS(req.GetSignBytes()); err == nil {
+		attributes = append(attributes,
+			attribute.String("chain_id", chainId),
+			attribute.Int64("height", height),
+			attribute.Int64("round", round),
+			attribute.String("step", stepLabel(step)),
+		)
+	}
+	return tracer.Start(ctx, name, trace.WithSpanKind(trace.SpanKindServer), trace.WithAttributes(attributes...))
+}
+
+// main loop for SignerServer, closing the socket once the server is stopped.
+// The socket is polled so that the loop notices the stop between requests.
 func (rs *SignerServer) loop() {
+	defer close(rs.done)
+	defer func() {
+		rs.Server.SetLinger(0)
+		rs.Server.Close()
+	}()
+	poller := zmq.NewPoller()
+	poller.Add(rs.Server, zmq.POLLIN)
 	for {
+		// BaseService only closes Quit after OnStop, which waits for the loop
+		if !rs.IsRunning() {
+			return
+		}
+		polled, err := poller.Poll(serverPollInterval)
+		if err != nil {
+			// interrupted by a signal
+			rs.Logger.Debug("poll error", "err", err)
+			continue
+		}
+		if len(polled) == 0 {
+			continue
+		}
 		msg, err := rs.Server.RecvMessageBytes(0)
-		req := MsgToRequest(msg)
+		var req CosignerRequest
+		if err == nil {
+			req, err = MsgToRequest(msg)
+		}
+		if ping, ok := req.(CosignerPingRequest); ok && err == nil {
+			rs.Logger.Debug("got ping", ping)
+			_, err = rs.Server.SendMessage(rs.pong().ToMsg())
+			if err != nil {
+				rs.Logger.Error(
+					"send ping reply",
+					err,
+				)
+			}
+			continue
+		}
+		if commitmentsReq, ok := req.(CosignerCommitmentsRequest); ok && err == nil {
+			rs.Logger.Debug("got commitments request", commitmentsReq)
+			_, err = rs.Server.SendMessage(rs.commitments(commitmentsReq))
+			if err != nil {
+				rs.Logger.Error(
+					"send commitments reply",
+					err,
+				)
+			}
+			continue
+		}
+		var local *LocalCosigner
 		if err == nil && req != nil {
+			local, err = rs.localFor(req)
+		}
+		if err == nil && req != nil {
+			ctx := contextFromHeader(msg[0])
 			switch v := req.(type) {
 			case CosignerSetSignatureRequest:
-				_, err = rs.Local.SetSignature(v)
+				ctx, span := rs.startSpan(ctx, "SignerServer.SetSignature", v)
+				_, err = local.SetSignature(ctx, v)
+				endSpan(span, err)
 				rs.Logger.Debug("got setsig", v)
 				to_send := make([][]byte, 2)
 				if err != nil {
@@ -87,8 +274,35 @@ func (rs *SignerServer) loop() {
 						err,
 					)
 				}
+			case CosignerSignRequest:
+				ctx, span := rs.startSpan(ctx, "SignerServer.Sign", v)
+				resp, err := local.SignPreprocessed(ctx, v)
+				endSpan(span, err)
+				rs.Logger.Debug("got sign", v)
+				to_send := make([][]byte, 2)
+				if resp.MaybeSig != nil {
+					rs.Logger.Debug("got sign sig", resp.MaybeSig)
+					to_send[0] = []byte("signature")
+					to_send[1] = resp.MaybeSig
+				} else if err != nil {
+					rs.Logger.Debug("got sign error", err)
+					to_send[0] = []byte("error")
+					to_send[1] = []byte(fmt.Sprintf("err: %v", err))
+				} else {
+					to_send[0] = []byte("share")
+					to_send[1] = resp.Share
+				}
+				_, err = rs.Server.SendMessage(to_send)
+				if err != nil {
+					rs.Logger.Error(
+						"send sign reply",
+						err,
+					)
+				}
 			case CosignerEndSessionRequest:
-				resp, err := rs.Local.EndSession(v)
+				ctx, span := rs.startSpan(ctx, "SignerServer.EndSession", v)
+				resp, err := local.EndSession(ctx, v)
+				endSpan(span, err)
 				rs.Logger.Debug("got end session", v)
 				to_send := make([][]byte, 2)
 				if resp.MaybeSig != nil {
@@ -111,7 +325,9 @@ func (rs *SignerServer) loop() {
 					)
 				}
 			case CosignerStartSessionRequest:
-				resp, err := rs.Local.StartSession(v)
+				ctx, span := rs.startSpan(ctx, "SignerServer.StartSession", v)
+				resp, err := local.StartSession(ctx, v)
+				endSpan(span, err)
 				rs.Logger.Debug("got start session", v)
 				to_send := make([][]byte, 2)
 				if resp.MaybeSig != nil {
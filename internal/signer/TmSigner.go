@@ -3,12 +3,20 @@
 package signer
 
 import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"sync"
 	"time"
 
+	"filippo.io/edwards25519"
+	"github.com/taurusgroup/frost-ed25519/pkg/frost/party"
 	"github.com/tendermint/tendermint/crypto"
-	tmcrypto "github.com/tendermint/tendermint/crypto/ed25519"
 	tmProto "github.com/tendermint/tendermint/proto/tendermint/types"
 	tm "github.com/tendermint/tendermint/types"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
 )
 
 type ThresholdValidator struct {
@@ -21,6 +29,27 @@ type ThresholdValidator struct {
 
 	// peer cosigners
 	peers *RemoteCosigners
+
+	// signing rounds in progress, shared with identical requests from other nodes
+	inflightMtx sync.Mutex
+	inflight    map[HRSKey]*inflightSign
+	// set by Drain, after which new signing rounds are refused
+	draining bool
+	// signing rounds in progress, including conflicting ones
+	rounds sync.WaitGroup
+
+	// commitments of the peers for preprocessed signing
+	commitments *commitmentPool
+}
+
+// inflightSign is a signing round whose result is shared by the requests coalesced into it
+type inflightSign struct {
+	signBytes []byte
+	done      chan struct{}
+	sig       []byte
+	stamp     time.Time
+	reserved  bool
+	err       error
 }
 
 // NewThresholdValidator creates and returns a new ThresholdValidator
@@ -29,7 +58,9 @@ func NewThresholdValidator(cosigner *LocalCosigner, peers *RemoteCosigners) *Thr
 	validator.threshold = peers.Threshold
 	validator.cosigner = cosigner
 	validator.peers = peers
-	validator.pubkey = tmcrypto.PubKey(cosigner.kgOutput.Shares.GroupKey().ToEd25519())
+	validator.inflight = make(map[HRSKey]*inflightSign)
+	validator.commitments = newCommitmentPool()
+	validator.pubkey = cosigner.pubKey()
 	return validator
 }
 
@@ -42,24 +73,46 @@ func (pv *ThresholdValidator) GetPubKey() (crypto.PubKey, error) {
 // SignVote signs a canonical representation of the vote, along with the
 // chainID. Implements PrivValidator.
 func (pv *ThresholdValidator) SignVote(chainID string, vote *tmProto.Vote) error {
+	_, err := pv.signVote(chainID, vote)
+	return err
+}
+
+// signVote signs the vote like SignVote, and returns whether the signature was re-served
+func (pv *ThresholdValidator) signVote(chainID string, vote *tmProto.Vote) (bool, error) {
+	if vote == nil {
+		return false, fmt.Errorf("%w: no vote", ErrInvalidRequest)
+	}
+	step, err := VoteToStep(vote)
+	if err != nil {
+		return false, err
+	}
 	block := &Block{
 		Height:    vote.Height,
 		Round:     int64(vote.Round),
-		Step:      VoteToStep(vote),
+		Step:      step,
 		Timestamp: vote.Timestamp,
 		SignBytes: tm.VoteSignBytes(chainID, vote),
 	}
-	sig, stamp, err := pv.signBlock(block)
+	sig, stamp, reserved, err := pv.sign(block)
 
 	vote.Signature = sig
 	vote.Timestamp = stamp
 
-	return err
+	return reserved, err
 }
 
 // SignProposal signs a canonical representation of the proposal, along with
 // the chainID. Implements PrivValidator.
 func (pv *ThresholdValidator) SignProposal(chainID string, proposal *tmProto.Proposal) error {
+	_, err := pv.signProposal(chainID, proposal)
+	return err
+}
+
+// signProposal signs the proposal like SignProposal, and returns whether the signature was re-served
+func (pv *ThresholdValidator) signProposal(chainID string, proposal *tmProto.Proposal) (bool, error) {
+	if proposal == nil {
+		return false, fmt.Errorf("%w: no proposal", ErrInvalidRequest)
+	}
 	block := &Block{
 		Height:    proposal.Height,
 		Round:     int64(proposal.Round),
@@ -67,12 +120,12 @@ func (pv *ThresholdValidator) SignProposal(chainID string, proposal *tmProto.Pro
 		Timestamp: proposal.Timestamp,
 		SignBytes: tm.ProposalSignBytes(chainID, proposal),
 	}
-	sig, stamp, err := pv.signBlock(block)
+	sig, stamp, reserved, err := pv.sign(block)
 
 	proposal.Signature = sig
 	proposal.Timestamp = stamp
 
-	return err
+	return reserved, err
 }
 
 type Block struct {
@@ -83,25 +136,142 @@ type Block struct {
 	Timestamp time.Time
 }
 
-func (pv *ThresholdValidator) signBlock(block *Block) ([]byte, time.Time, error) {
+// sign produces the threshold signature for the block.
+//
+// Nodes behind sentries send the same request several times. A request for the HRS
+// of a round in progress whose sign bytes only differ by the timestamp joins that
+// round and gets its signature and timestamp, as it would get them from the sign state
+// once the round is over.
+//
+// The signature is re-served if it was produced before, by us or a peer, or by the round
+// the request joined.
+func (pv *ThresholdValidator) sign(block *Block) ([]byte, time.Time, bool, error) {
+	hrsKey := HRSKey{
+		Height: block.Height,
+		Round:  block.Round,
+		Step:   block.Step,
+	}
+	pv.inflightMtx.Lock()
+	if pv.draining {
+		pv.inflightMtx.Unlock()
+		return nil, block.Timestamp, false, ErrShuttingDown
+	}
+	if call, ok := pv.inflight[hrsKey]; ok && sameRequest(block.Step, call.signBytes, block.SignBytes) {
+		pv.inflightMtx.Unlock()
+		metricSignCoalesced.WithLabelValues(pv.cosigner.ChainID(), stepLabel(block.Step)).Inc()
+		<-call.done
+		return call.sig, call.stamp, call.sig != nil, call.err
+	}
+	call := &inflightSign{signBytes: block.SignBytes, done: make(chan struct{})}
+	// a conflicting request does not replace the round in progress,
+	// it runs on its own and is refused by the cosigners
+	_, conflicting := pv.inflight[hrsKey]
+	if !conflicting {
+		pv.inflight[hrsKey] = call
+	}
+	pv.rounds.Add(1)
+	defer pv.rounds.Done()
+	pv.inflightMtx.Unlock()
+
+	call.sig, call.stamp, call.reserved, call.err = pv.signBlock(block)
+
+	if !conflicting {
+		pv.inflightMtx.Lock()
+		delete(pv.inflight, hrsKey)
+		pv.inflightMtx.Unlock()
+	}
+	close(call.done)
+	return call.sig, call.stamp, call.reserved, call.err
+}
+
+// Drain refuses new signing rounds and waits until the rounds in progress are over,
+// or the context is done
+func (pv *ThresholdValidator) Drain(ctx context.Context) error {
+	pv.inflightMtx.Lock()
+	pv.draining = true
+	pv.inflightMtx.Unlock()
+
+	drained := make(chan struct{})
+	go func() {
+		pv.rounds.Wait()
+		close(drained)
+	}()
+	select {
+	case <-drained:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// sameRequest returns whether the sign bytes are equal or only differ by the timestamp
+func sameRequest(step int8, signBytes []byte, other []byte) bool {
+	if bytes.Equal(signBytes, other) {
+		return true
+	}
+	_, ok := CheckOnlyDifferByTimestamp(step, signBytes, other)
+	return ok
+}
+
+// signBlock produces the threshold signature for the block, records its outcome in the metrics
+// and traces it, each step of the round being a child span.
+//
+// The signature is produced in a single round trip if commitments of all the peers are at hand,
+// and by the two-round protocol otherwise.
+func (pv *ThresholdValidator) signBlock(block *Block) ([]byte, time.Time, bool, error) {
+	ctx, span := tracer.Start(context.Background(), "ThresholdValidator.signBlock", trace.WithAttributes(
+		attribute.String("chain_id", pv.cosigner.ChainID()),
+		attribute.Int64("height", block.Height),
+		attribute.Int64("round", block.Round),
+		attribute.String("step", stepLabel(block.Step)),
+	))
+	start := time.Now()
+	sig, stamp, reserved, err := pv.preprocessedSign(ctx, block)
+	if errors.Is(err, errNotPreprocessed) {
+		span.AddEvent("falling back to two rounds", trace.WithAttributes(attribute.String("reason", err.Error())))
+		sig, stamp, reserved, err = pv.thresholdSign(ctx, block)
+	}
+	pv.observeSign(block.Step, time.Since(start), err)
+	endSpan(span, err)
+	return sig, stamp, reserved, err
+}
+
+func (pv *ThresholdValidator) observeSign(step int8, elapsed time.Duration, err error) {
+	chainID := pv.cosigner.ChainID()
+	if err != nil {
+		metricSignRequests.WithLabelValues(chainID, stepLabel(step), "failure", ErrorClass(err), ErrorReason(err)).Inc()
+		return
+	}
+	metricSignDuration.WithLabelValues(chainID, stepLabel(step)).Observe(elapsed.Seconds())
+	metricSignRequests.WithLabelValues(chainID, stepLabel(step), "success", "", "").Inc()
+}
+
+func (pv *ThresholdValidator) thresholdSign(ctx context.Context, block *Block) ([]byte, time.Time, bool, error) {
 	stamp := block.Timestamp
 	startReq := CosignerStartSessionRequest{}
 	startReq.ID = pv.peers.LocalID
 	startReq.PartyIDs = pv.peers.ResetParties()
 	startReq.SignBytes = block.SignBytes
-	resp, err := pv.cosigner.StartSession(startReq)
+	stepCtx, span := tracer.Start(ctx, "local StartSession")
+	resp, err := pv.cosigner.StartSession(stepCtx, startReq)
+	endSpan(span, err)
 	if resp.MaybeSig != nil {
-		return resp.MaybeSig, stamp, nil
+		if err := pv.checkOwnSignature(block.SignBytes, resp.MaybeSig); err != nil {
+			return nil, stamp, false, err
+		}
+		return resp.MaybeSig, stamp, true, nil
 	}
 	if err != nil {
-		return nil, stamp, err
+		return nil, stamp, false, err
 	}
-	otherResp, err := pv.peers.StartSession(startReq)
-	if otherResp.MaybeSig != nil {
-		return otherResp.MaybeSig, stamp, nil
+	stepCtx, span = tracer.Start(ctx, "remote StartSession")
+	otherResp, err := pv.peers.StartSession(stepCtx, startReq)
+	endSpan(span, err)
+	if sig, err := pv.peerSignature("start_session", block, otherResp.PeerSigs); sig != nil || err != nil {
+		return sig, stamp, sig != nil, err
 	}
 	if err != nil {
-		return nil, stamp, err
+		return nil, stamp, false, err
 	}
 	msgsOut1 := make([][]byte, 0, pv.threshold+1)
 	msgsOut1 = append(msgsOut1, resp.Msg1Out...)
@@ -111,21 +281,29 @@ func (pv *ThresholdValidator) signBlock(block *Block) ([]byte, time.Time, error)
 	endReq.PartyIDs = startReq.PartyIDs
 	endReq.SignBytes = block.SignBytes
 	endReq.Msg1Out = msgsOut1
-	resp2, err := pv.cosigner.EndSession(endReq)
+	stepCtx, span = tracer.Start(ctx, "local EndSession")
+	resp2, err := pv.cosigner.EndSession(stepCtx, endReq)
+	endSpan(span, err)
 	if resp2.MaybeSig != nil {
-		return resp2.MaybeSig, stamp, nil
+		if err := pv.checkOwnSignature(block.SignBytes, resp2.MaybeSig); err != nil {
+			return nil, stamp, false, err
+		}
+		return resp2.MaybeSig, stamp, true, nil
 	}
 	if err != nil {
-		return nil, stamp, err
+		pv.reportMisbehavior("end_session", block.SignBytes, err)
+		return nil, stamp, false, err
 	}
-	otherResp2, err := pv.peers.EndSession(endReq)
-	if otherResp2.MaybeSig != nil {
-		return otherResp2.MaybeSig, stamp, nil
+	stepCtx, span = tracer.Start(ctx, "remote EndSession")
+	otherResp2, err := pv.peers.EndSession(stepCtx, endReq)
+	endSpan(span, err)
+	if sig, err := pv.peerSignature("end_session", block, otherResp2.PeerSigs); sig != nil || err != nil {
+		return sig, stamp, sig != nil, err
 	}
 	if err != nil {
-		return nil, stamp, err
+		return nil, stamp, false, err
 	}
-	msgsOut2 := make([][]byte, 0, len(pv.peers.Clients)+1)
+	msgsOut2 := make([][]byte, 0, len(endReq.PartyIDs))
 	msgsOut2 = append(msgsOut2, resp2.Msg2Out...)
 	msgsOut2 = append(msgsOut2, otherResp2.Msg2Out...)
 	hrsKey := HRSKey{
@@ -133,14 +311,192 @@ func (pv *ThresholdValidator) signBlock(block *Block) ([]byte, time.Time, error)
 		Round:  block.Round,
 		Step:   block.Step,
 	}
+	_, span = tracer.Start(ctx, "FinalSign")
 	sig, err := pv.cosigner.FinalSign(hrsKey, endReq.PartyIDs, msgsOut2)
+	endSpan(span, err)
+	if err != nil {
+		pv.reportMisbehavior("final_sign", block.SignBytes, err)
+		return nil, stamp, false, err
+	}
+	pv.peers.RecordSuccess(pv.peers.sessionPeers(endReq.PartyIDs))
+	sigReq := CosignerSetSignatureRequest{}
+	sigReq.ID = pv.peers.LocalID
+	sigReq.Sig = sig
+	sigReq.SignBytes = block.SignBytes
+	stepCtx, span = tracer.Start(ctx, "remote SetSignature")
+	_, err = pv.peers.SetSignature(stepCtx, sigReq)
+	endSpan(span, err)
+	return sig, stamp, false, nil
+}
+
+// reportMisbehavior records the peer a failed round is attributed to, if any
+func (pv *ThresholdValidator) reportMisbehavior(request string, signBytes []byte, err error) {
+	var protocolErr *ProtocolError
+	if errors.As(err, &protocolErr) && protocolErr.Culprit != 0 && protocolErr.Culprit != pv.peers.LocalID {
+		pv.peers.RecordMisbehavior(protocolErr.Culprit, request, signBytes, protocolErr)
+	}
+}
+
+// peerSignature returns a signature of the block the peers replied with, if one verifies
+// against the group key, after recording it in our sign state like one we produced:
+// requests for the HRS or below are refused from now on.
+// The peers that replied with an invalid signature are reported.
+func (pv *ThresholdValidator) peerSignature(request string, block *Block, sigs map[byte][]byte) ([]byte, error) {
+	var valid []byte
+	for id, sig := range sigs {
+		if pv.pubkey.VerifySignature(block.SignBytes, sig) {
+			valid = sig
+			continue
+		}
+		pv.reportMisbehavior(request, block.SignBytes, &ProtocolError{Culprit: id, Err: ErrInvalidSignature})
+	}
+	if valid == nil {
+		return nil, nil
+	}
+	hrsKey := HRSKey{
+		Height: block.Height,
+		Round:  block.Round,
+		Step:   block.Step,
+	}
+	if err := pv.cosigner.RecordSignature(hrsKey, block.SignBytes, valid); err != nil {
+		return nil, err
+	}
+	return valid, nil
+}
+
+// checkOwnSignature checks a signature our own cosigner re-served from its sign state
+func (pv *ThresholdValidator) checkOwnSignature(signBytes []byte, sig []byte) error {
+	if !pv.pubkey.VerifySignature(signBytes, sig) {
+		return fmt.Errorf("%w in the sign state", ErrInvalidSignature)
+	}
+	return nil
+}
+
+// errNotPreprocessed is returned by preprocessedSign when the signature has to be
+// produced by the two-round protocol instead
+var errNotPreprocessed = errors.New("preprocessed signing not possible")
+
+// preprocessedSign produces the signature in a single round trip with commitments
+// the peers handed out beforehand.
+//
+// Whatever the outcome, each commitment is only ever sent once: the cosigners refuse
+// commitments they do not hold a nonce for.
+func (pv *ThresholdValidator) preprocessedSign(ctx context.Context, block *Block) ([]byte, time.Time, bool, error) {
+	stamp := block.Timestamp
+	partyIDs := pv.peers.ResetParties()
+	peerIDs := pv.peers.sessionPeers(partyIDs)
+	defer pv.refillCommitments(peerIDs)
+	commitments, ok := pv.commitments.take(peerIDs)
+	if !ok {
+		return nil, stamp, false, fmt.Errorf("%w: no commitments at hand", errNotPreprocessed)
+	}
+	own, err := pv.cosigner.Commitments(pv.peers.LocalID, 1)
 	if err != nil {
-		return nil, stamp, err
+		return nil, stamp, false, err
+	}
+	commitments = append(commitments, own[0])
+
+	req := CosignerSignRequest{}
+	req.ID = pv.peers.LocalID
+	req.SignBytes = block.SignBytes
+	for i := range commitments {
+		req.Commitments = append(req.Commitments, commitments[i].Bytes())
+	}
+	stepCtx, span := tracer.Start(ctx, "local Sign")
+	resp, err := pv.cosigner.SignPreprocessed(stepCtx, req)
+	endSpan(span, err)
+	if resp.MaybeSig != nil {
+		if err := pv.checkOwnSignature(block.SignBytes, resp.MaybeSig); err != nil {
+			return nil, stamp, false, err
+		}
+		return resp.MaybeSig, stamp, true, nil
 	}
+	if err != nil {
+		return nil, stamp, false, err
+	}
+	shares := make(map[party.ID]*edwards25519.Scalar, len(partyIDs))
+	shares[party.ID(pv.peers.LocalID)], err = edwards25519.NewScalar().SetCanonicalBytes(resp.Share)
+	if err != nil {
+		return nil, stamp, false, &ProtocolError{Err: err}
+	}
+
+	stepCtx, span = tracer.Start(ctx, "remote Sign")
+	replies := pv.peers.SignPreprocessed(stepCtx, peerIDs, req)
+	span.End()
+	for _, id := range peerIDs {
+		reply, ok := replies[id]
+		if !ok {
+			// the peer may have restarted, losing the nonces of its commitments
+			pv.commitments.drop(id)
+			continue
+		}
+		if reply.MaybeSig != nil {
+			if sig, err := pv.peerSignature("sign", block, map[byte][]byte{id: reply.MaybeSig}); sig != nil || err != nil {
+				return sig, stamp, sig != nil, err
+			}
+			continue
+		}
+		z, err := edwards25519.NewScalar().SetCanonicalBytes(reply.Share)
+		if err != nil {
+			pv.reportMisbehavior("sign", block.SignBytes, &ProtocolError{Culprit: id, Err: err})
+			continue
+		}
+		shares[party.ID(id)] = z
+	}
+	if len(shares) < len(partyIDs) {
+		return nil, stamp, false, fmt.Errorf("%w: %d of %d signature shares", errNotPreprocessed, len(shares), len(partyIDs))
+	}
+
+	round, err := newPreprocessedRound(pv.cosigner.kgOutput.Shares, block.SignBytes, commitments)
+	if err != nil {
+		return nil, stamp, false, &ProtocolError{Err: err}
+	}
+	signature, err := round.aggregate(pv.cosigner.kgOutput.Shares, block.SignBytes, shares)
+	if err != nil {
+		pv.reportMisbehavior("sign", block.SignBytes, err)
+		return nil, stamp, false, fmt.Errorf("%w: %v", errNotPreprocessed, err)
+	}
+	sig := signature.ToEd25519()
+	pv.peers.RecordSuccess(peerIDs)
+
+	hrsKey := HRSKey{
+		Height: block.Height,
+		Round:  block.Round,
+		Step:   block.Step,
+	}
+	_, span = tracer.Start(ctx, "FinalSign")
+	err = pv.cosigner.RecordSignature(hrsKey, block.SignBytes, sig)
+	endSpan(span, err)
+	if err != nil {
+		return nil, stamp, false, err
+	}
+
+	// the signature is returned without waiting for the peers to record it
 	sigReq := CosignerSetSignatureRequest{}
 	sigReq.ID = pv.peers.LocalID
 	sigReq.Sig = sig
 	sigReq.SignBytes = block.SignBytes
-	pv.peers.SetSignature(sigReq)
-	return sig, stamp, nil
+	go func() {
+		stepCtx, span := tracer.Start(ctx, "remote SetSignature")
+		_, err := pv.peers.SetSignature(stepCtx, sigReq)
+		endSpan(span, err)
+	}()
+	return sig, stamp, false, nil
+}
+
+// refillCommitments requests commitments in the background from the peers running low on them
+func (pv *ThresholdValidator) refillCommitments(ids []byte) {
+	for _, id := range ids {
+		n := pv.commitments.startRefill(id)
+		if n == 0 {
+			continue
+		}
+		go func(id byte, n int) {
+			commitments, err := pv.peers.RequestCommitments(context.Background(), pv.cosigner.ChainID(), id, n)
+			if err != nil {
+				commitments = nil
+			}
+			pv.commitments.endRefill(id, commitments)
+		}(id, n)
+	}
 }
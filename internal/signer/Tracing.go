@@ -0,0 +1,120 @@
+package signer
+
+import (
+	"context"
+	"fmt"
+	"os"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracegrpc"
+	"go.opentelemetry.io/otel/exporters/stdout/stdouttrace"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.4.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+var tracer = otel.Tracer("github.com/tomtau/tmkms-threshold/internal/signer")
+
+// the trace context is carried between cosigners in W3C traceparent format
+var tracePropagator = propagation.TraceContext{}
+
+// TracingConfig configures the export of the signing traces
+type TracingConfig struct {
+	// "otlp", "file" or empty to disable tracing
+	Exporter string `toml:"exporter"`
+	// host:port of the OTLP gRPC collector
+	OtlpEndpoint string `toml:"otlp_endpoint"`
+	OtlpInsecure bool   `toml:"otlp_insecure"`
+	// file the spans are appended to as JSON by the file exporter
+	File string `toml:"file"`
+	// fraction of the signing rounds started locally that are traced (default 1)
+	SampleRatio *float64 `toml:"sample_ratio"`
+	// defaults to "tmkms-threshold"
+	ServiceName string `toml:"service_name"`
+}
+
+// SetupTracing installs the global tracer provider described by the config.
+// The returned function flushes and stops the exporter.
+func SetupTracing(cfg TracingConfig, cosignerID byte) (func(context.Context) error, error) {
+	var exporter sdktrace.SpanExporter
+	switch cfg.Exporter {
+	case "":
+		return func(context.Context) error { return nil }, nil
+	case "otlp":
+		opts := []otlptracegrpc.Option{otlptracegrpc.WithEndpoint(cfg.OtlpEndpoint)}
+		if cfg.OtlpInsecure {
+			opts = append(opts, otlptracegrpc.WithInsecure())
+		}
+		otlpExporter, err := otlptracegrpc.New(context.Background(), opts...)
+		if err != nil {
+			return nil, err
+		}
+		exporter = otlpExporter
+	case "file":
+		file, err := os.OpenFile(cfg.File, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600)
+		if err != nil {
+			return nil, err
+		}
+		fileExporter, err := stdouttrace.New(stdouttrace.WithWriter(file))
+		if err != nil {
+			return nil, err
+		}
+		exporter = fileExporter
+	default:
+		return nil, fmt.Errorf("unknown tracing exporter %q", cfg.Exporter)
+	}
+
+	serviceName := cfg.ServiceName
+	if serviceName == "" {
+		serviceName = "tmkms-threshold"
+	}
+	ratio := 1.0
+	if cfg.SampleRatio != nil {
+		ratio = *cfg.SampleRatio
+	}
+	provider := sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exporter),
+		sdktrace.WithSampler(sdktrace.ParentBased(sdktrace.TraceIDRatioBased(ratio))),
+		sdktrace.WithResource(resource.NewWithAttributes(
+			semconv.SchemaURL,
+			semconv.ServiceNameKey.String(serviceName),
+			attribute.Int("cosigner.id", int(cosignerID)),
+		)),
+	)
+	otel.SetTracerProvider(provider)
+	return provider.Shutdown, nil
+}
+
+// requestHeader returns the first frame of a cosigner request:
+// the request type and party ID, followed by the traceparent of the span in ctx (if any).
+// Cosigners not supporting tracing ignore the trailing bytes.
+func requestHeader(ctx context.Context, requestType byte, partyID byte) []byte {
+	header := []byte{requestType, partyID}
+	carrier := propagation.HeaderCarrier{}
+	tracePropagator.Inject(ctx, carrier)
+	return append(header, carrier.Get("traceparent")...)
+}
+
+// contextFromHeader returns a context carrying the remote span of a request header, if any
+func contextFromHeader(header []byte) context.Context {
+	ctx := context.Background()
+	if len(header) <= 2 {
+		return ctx
+	}
+	carrier := propagation.HeaderCarrier{}
+	carrier.Set("traceparent", string(header[2:]))
+	return tracePropagator.Extract(ctx, carrier)
+}
+
+// endSpan records the error (if any) on the span and ends it
+func endSpan(span trace.Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, ErrorReason(err))
+	}
+	span.End()
+}
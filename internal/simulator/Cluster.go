@@ -0,0 +1,290 @@
+// Package simulator runs a cluster of cosigners in one process on loopback
+// and drives it with a scripted stream of votes and proposals, the way the
+// Tendermint nodes of the cosigners would, to check the signatures produced
+// and the watermark kept by each cosigner.
+package simulator
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/taurusgroup/frost-ed25519/pkg/frost"
+	"github.com/taurusgroup/frost-ed25519/pkg/frost/keygen"
+	"github.com/taurusgroup/frost-ed25519/pkg/frost/party"
+	"github.com/taurusgroup/frost-ed25519/pkg/helpers"
+	"github.com/taurusgroup/frost-ed25519/pkg/state"
+	"github.com/tendermint/tendermint/crypto"
+	tmcrypto "github.com/tendermint/tendermint/crypto/ed25519"
+	tmlog "github.com/tendermint/tendermint/libs/log"
+	internalSigner "github.com/tomtau/tmkms-threshold/internal/signer"
+)
+
+// Options describe the cluster to simulate
+type Options struct {
+	// number of cosigners
+	Cosigners int
+	// cosigner_threshold of every cosigner: Threshold + 1 cosigners sign together
+	Threshold int
+	ChainID   string
+	// directory for the key shares and sign states; a temporary directory
+	// removed by Stop is used if empty
+	Dir    string
+	Logger tmlog.Logger
+	// session_timeout_sec of every cosigner, 5 if 0
+	SessionTimeoutSec int
+	// faults injected into the requests of every cosigner to its peers
+	Chaos internalSigner.ChaosConfig
+}
+
+// Cosigner is one cosigner of the cluster, serving its peers and signing for its own node
+type Cosigner struct {
+	ID     byte
+	Config internalSigner.CoConfig
+	Local  *internalSigner.LocalCosigner
+	Server *internalSigner.SignerServer
+	Chain  *internalSigner.Chain
+}
+
+// Cluster is a running set of cosigners of one chain
+type Cluster struct {
+	ChainID   string
+	PubKey    crypto.PubKey
+	Cosigners []*Cosigner
+
+	dir        string
+	removeDir  bool
+	stateFiles map[byte]string
+}
+
+// Keygen runs the distributed key generation for n cosigners in process
+// and returns their key shares, indexed by cosigner ID - 1
+func Keygen(n int, threshold int) ([]internalSigner.KeyGenOutput, error) {
+	partySet := helpers.GenerateSet(party.Size(n))
+	states := make([]*state.State, n)
+	outputs := make([]*keygen.Output, n)
+	for i := range states {
+		var err error
+		states[i], outputs[i], err = frost.NewKeygenState(party.ID(i+1), partySet, party.Size(threshold), 0)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	// every round takes the messages of all parties in the previous round
+	var msgs [][]byte
+	for round := 0; round < 3; round++ {
+		var next [][]byte
+		for _, s := range states {
+			out, err := helpers.PartyRoutine(msgs, s)
+			if err != nil {
+				return nil, fmt.Errorf("keygen round %d: %w", round+1, err)
+			}
+			next = append(next, out...)
+		}
+		msgs = next
+	}
+
+	shares := make([]internalSigner.KeyGenOutput, n)
+	for i, s := range states {
+		if err := s.WaitForError(); err != nil {
+			return nil, err
+		}
+		shares[i] = internalSigner.KeyGenOutput{
+			Secret: outputs[i].SecretKey,
+			Shares: outputs[i].Public,
+		}
+	}
+	return shares, nil
+}
+
+// NewCluster runs the keygen and starts the cosigners, each listening on a free loopback port
+func NewCluster(opts Options) (*Cluster, error) {
+	if opts.Cosigners < 2 || opts.Threshold < 1 || opts.Threshold >= opts.Cosigners {
+		return nil, fmt.Errorf("cannot simulate %d cosigners with threshold %d", opts.Cosigners, opts.Threshold)
+	}
+	if opts.ChainID == "" {
+		opts.ChainID = "simulator"
+	}
+	if opts.Logger == nil {
+		opts.Logger = tmlog.NewNopLogger()
+	}
+	if opts.SessionTimeoutSec == 0 {
+		opts.SessionTimeoutSec = 5
+	}
+	cluster := &Cluster{
+		ChainID:    opts.ChainID,
+		dir:        opts.Dir,
+		stateFiles: make(map[byte]string),
+	}
+	if cluster.dir == "" {
+		dir, err := ioutil.TempDir("", "simulator")
+		if err != nil {
+			return nil, err
+		}
+		cluster.dir = dir
+		cluster.removeDir = true
+	}
+
+	shares, err := Keygen(opts.Cosigners, opts.Threshold)
+	if err != nil {
+		cluster.Stop()
+		return nil, err
+	}
+	cluster.PubKey = tmcrypto.PubKey(shares[0].Shares.GroupKey().ToEd25519())
+
+	for i, share := range shares {
+		id := byte(i + 1)
+		cosigner, err := cluster.newCosigner(id, share, opts)
+		if err != nil {
+			cluster.Stop()
+			return nil, fmt.Errorf("cosigner %d: %w", id, err)
+		}
+		cluster.Cosigners = append(cluster.Cosigners, cosigner)
+		cluster.stateFiles[id] = cosigner.Config.PrivValStateFile
+	}
+
+	// the peers are only known once every cosigner listens
+	for _, cosigner := range cluster.Cosigners {
+		for _, peer := range cluster.Cosigners {
+			if peer.ID != cosigner.ID {
+				cosigner.Config.Cosigners = append(cosigner.Config.Cosigners, internalSigner.CosignerConfig{
+					ID:      int(peer.ID),
+					Address: peer.Config.ListenAddress,
+				})
+			}
+		}
+		if err := cosigner.Config.Validate(); err != nil {
+			cluster.Stop()
+			return nil, err
+		}
+		if err := cosigner.Server.Start(); err != nil {
+			cluster.Stop()
+			return nil, fmt.Errorf("cosigner %d: %w", cosigner.ID, err)
+		}
+		cosigner.Chain, err = internalSigner.NewChain(opts.Logger.With("cosigner", cosigner.ID), cosigner.Config, cosigner.Local, nil)
+		if err != nil {
+			cluster.Stop()
+			return nil, fmt.Errorf("cosigner %d: %w", cosigner.ID, err)
+		}
+	}
+	return cluster, nil
+}
+
+// newCosigner writes the key share of the cosigner and creates its server, listening on a free loopback port
+func (cluster *Cluster) newCosigner(id byte, share internalSigner.KeyGenOutput, opts Options) (*Cosigner, error) {
+	jsonData, err := json.MarshalIndent(share, "", " ")
+	if err != nil {
+		return nil, err
+	}
+	keySharePath := filepath.Join(cluster.dir, fmt.Sprintf("share_%d.json", id))
+	if err := ioutil.WriteFile(keySharePath, jsonData, 0600); err != nil {
+		return nil, err
+	}
+
+	config := internalSigner.CoConfig{
+		KeySharePath:      keySharePath,
+		PrivValStateFile:  filepath.Join(cluster.dir, fmt.Sprintf("state_%d.json", id)),
+		ChainID:           opts.ChainID,
+		CosignerId:        id,
+		CosignerThreshold: byte(opts.Threshold),
+		SessionTimeoutSec: opts.SessionTimeoutSec,
+		Chaos:             opts.Chaos,
+	}
+	local, err := internalSigner.NewLocalCosigner(config, config.ChainConfigs()[0])
+	if err != nil {
+		return nil, err
+	}
+	locals := []*internalSigner.LocalCosigner{local}
+	logger := opts.Logger.With("cosigner", id)
+
+	// a port found free may be taken by an outgoing connection before it is bound
+	for attempt := 0; ; attempt++ {
+		port, err := freePort()
+		if err != nil {
+			return nil, err
+		}
+		config.ListenAddress = fmt.Sprintf("tcp://127.0.0.1:%d", port)
+		server, err := internalSigner.NewSignerServer(logger, locals, config)
+		if err == nil {
+			return &Cosigner{
+				ID:     id,
+				Config: config,
+				Local:  local,
+				Server: server,
+			}, nil
+		}
+		if attempt == bindAttempts {
+			return nil, err
+		}
+	}
+}
+
+// Cosigner returns the cosigner with the ID
+func (cluster *Cluster) Cosigner(id byte) *Cosigner {
+	for _, cosigner := range cluster.Cosigners {
+		if cosigner.ID == id {
+			return cosigner
+		}
+	}
+	return nil
+}
+
+// how many times a cosigner tries another port if binding its listen address fails
+const bindAttempts = 10
+
+// how long Stop waits for the signing rounds in progress
+const drainTimeout = 5 * time.Second
+
+// Stop stops the cosigners the way the signer does on shutdown,
+// and removes the temporary directory of the cluster
+func (cluster *Cluster) Stop() error {
+	var firstErr error
+	ctx, cancel := context.WithTimeout(context.Background(), drainTimeout)
+	defer cancel()
+	for _, cosigner := range cluster.Cosigners {
+		if cosigner.Chain == nil {
+			continue
+		}
+		if err := cosigner.Chain.Stop(ctx); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	for _, cosigner := range cluster.Cosigners {
+		if !cosigner.Server.IsRunning() {
+			// never started: only its socket needs closing
+			cosigner.Server.OnStop()
+			continue
+		}
+		if err := cosigner.Server.Stop(); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	for _, cosigner := range cluster.Cosigners {
+		if err := cosigner.Local.Close(); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	cluster.Cosigners = nil
+	if cluster.removeDir {
+		if err := os.RemoveAll(cluster.dir); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	return firstErr
+}
+
+// freePort returns a loopback TCP port that was free when asked
+func freePort() (int, error) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return 0, err
+	}
+	defer listener.Close()
+	return listener.Addr().(*net.TCPAddr).Port, nil
+}
@@ -0,0 +1,317 @@
+package simulator
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	tmProto "github.com/tendermint/tendermint/proto/tendermint/types"
+	tm "github.com/tendermint/tendermint/types"
+	internalSigner "github.com/tomtau/tmkms-threshold/internal/signer"
+)
+
+// Expect is the outcome a step of a script must have
+type Expect int
+
+const (
+	// every node of the step gets a valid signature
+	ExpectSigned Expect = iota
+	// every node of the step is refused a signature
+	ExpectRefused
+	// the nodes of the step may or may not get a signature
+	ExpectAny
+)
+
+func (expect Expect) String() string {
+	switch expect {
+	case ExpectRefused:
+		return "refused"
+	case ExpectAny:
+		return "any"
+	}
+	return "signed"
+}
+
+// Step is one request of a script: a vote or a proposal sent by the nodes of some cosigners
+type Step struct {
+	Name     string
+	Vote     *tmProto.Vote
+	Proposal *tmProto.Proposal
+	// the cosigners whose nodes send the request concurrently; all of them if empty
+	Cosigners []byte
+	Expect    Expect
+}
+
+// Result is the outcome of a step for the node of one cosigner
+type Result struct {
+	Step      string
+	Cosigner  byte
+	Height    int64
+	Round     int64
+	StepType  int8
+	SignBytes []byte
+	Signature []byte
+	Err       error
+}
+
+// Report collects the results of a script and the problems found in them
+type Report struct {
+	Results  []Result
+	Failures []string
+	Duration time.Duration
+}
+
+// OK is true if no problem was found
+func (report *Report) OK() bool {
+	return len(report.Failures) == 0
+}
+
+func (report *Report) failf(format string, args ...interface{}) {
+	report.Failures = append(report.Failures, fmt.Sprintf(format, args...))
+}
+
+// Signed returns the number of signatures produced
+func (report *Report) Signed() int {
+	signed := 0
+	for _, result := range report.Results {
+		if result.Err == nil {
+			signed++
+		}
+	}
+	return signed
+}
+
+// String summarizes the report
+func (report *Report) String() string {
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "%d requests, %d signed, %d refused in %v\n",
+		len(report.Results), report.Signed(), len(report.Results)-report.Signed(), report.Duration.Round(time.Millisecond))
+	if report.OK() {
+		sb.WriteString("OK\n")
+	}
+	for _, failure := range report.Failures {
+		fmt.Fprintf(&sb, "FAIL: %s\n", failure)
+	}
+	return sb.String()
+}
+
+var (
+	scriptTime  = time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC)
+	scriptBlock = blockID("block")
+)
+
+func blockID(name string) tmProto.BlockID {
+	hash := sha256.Sum256([]byte(name))
+	parts := sha256.Sum256([]byte(name + "/parts"))
+	return tmProto.BlockID{
+		Hash:          hash[:],
+		PartSetHeader: tmProto.PartSetHeader{Total: 1, Hash: parts[:]},
+	}
+}
+
+func vote(voteType tmProto.SignedMsgType, height int64, round int32, block tmProto.BlockID, timestamp time.Time) *tmProto.Vote {
+	return &tmProto.Vote{
+		Type:      voteType,
+		Height:    height,
+		Round:     round,
+		BlockID:   block,
+		Timestamp: timestamp,
+	}
+}
+
+func proposal(height int64, round int32, block tmProto.BlockID, timestamp time.Time) *tmProto.Proposal {
+	return &tmProto.Proposal{
+		Type:      tmProto.ProposalType,
+		Height:    height,
+		Round:     round,
+		PolRound:  -1,
+		BlockID:   block,
+		Timestamp: timestamp,
+	}
+}
+
+// DefaultScript returns a script of the given number of heights, each with a proposal,
+// a prevote and a precommit signed for the nodes of all cosigners, followed by requests
+// the cosigners must answer from their watermark: a repeated precommit, which gets
+// the earlier signature, a re-timestamped precommit, which is signed again,
+// and a conflicting precommit and a regression, which are refused. The last height is then signed in round 1
+// by the node of the first cosigner only.
+func DefaultScript(heights int) []Step {
+	var script []Step
+	var height int64
+	for height = 1; height <= int64(heights); height++ {
+		stamp := scriptTime.Add(time.Duration(height) * time.Second)
+		script = append(script,
+			Step{Name: fmt.Sprintf("proposal %d/0", height), Proposal: proposal(height, 0, scriptBlock, stamp)},
+			Step{Name: fmt.Sprintf("prevote %d/0", height), Vote: vote(tmProto.PrevoteType, height, 0, scriptBlock, stamp)},
+			Step{Name: fmt.Sprintf("precommit %d/0", height), Vote: vote(tmProto.PrecommitType, height, 0, scriptBlock, stamp)},
+		)
+	}
+	last := height - 1
+	stamp := scriptTime.Add(time.Duration(last) * time.Second)
+	return append(script,
+		Step{Name: "repeated precommit", Vote: vote(tmProto.PrecommitType, last, 0, scriptBlock, stamp)},
+		Step{Name: "re-timestamped precommit", Vote: vote(tmProto.PrecommitType, last, 0, scriptBlock, stamp.Add(time.Second))},
+		Step{Name: "conflicting precommit", Vote: vote(tmProto.PrecommitType, last, 0, blockID("other block"), stamp), Expect: ExpectRefused},
+		Step{Name: "regressed prevote", Vote: vote(tmProto.PrevoteType, last, 0, scriptBlock, stamp), Expect: ExpectRefused},
+		Step{Name: fmt.Sprintf("prevote %d/1 by cosigner 1", last), Vote: vote(tmProto.PrevoteType, last, 1, tmProto.BlockID{}, stamp), Cosigners: []byte{1}},
+	)
+}
+
+// BestEffort returns the script with the steps expected to be signed allowed to fail,
+// as they may when faults are injected; the steps expected to be refused still must be
+func BestEffort(script []Step) []Step {
+	steps := make([]Step, len(script))
+	for i, step := range script {
+		if step.Expect == ExpectSigned {
+			step.Expect = ExpectAny
+		}
+		steps[i] = step
+	}
+	return steps
+}
+
+// Run sends the steps of the script in order to the nodes of the cosigners
+// and checks the results:
+//   - every step has the expected outcome
+//   - every signature verifies against the group key
+//   - no two sign bytes differing by more than the timestamp are signed at the same
+//     height, round and step
+//   - the watermark of no cosigner ever regresses or passes the highest signature,
+//     and the sign state saved by the cosigners matches the one they hold
+func (cluster *Cluster) Run(script []Step) *Report {
+	report := &Report{}
+	start := time.Now()
+	watermarks := make(map[byte]internalSigner.HRSKey)
+	for _, step := range script {
+		results := cluster.runStep(step)
+		for _, result := range results {
+			cluster.checkResult(report, step, result)
+		}
+		report.Results = append(report.Results, results...)
+		cluster.checkWatermarks(report, step.Name, watermarks)
+	}
+	report.Duration = time.Since(start)
+	checkDoubleSigns(report)
+	return report
+}
+
+func (cluster *Cluster) runStep(step Step) []Result {
+	ids := step.Cosigners
+	if len(ids) == 0 {
+		for _, cosigner := range cluster.Cosigners {
+			ids = append(ids, cosigner.ID)
+		}
+	}
+	results := make([]Result, len(ids))
+	var wg sync.WaitGroup
+	for i, id := range ids {
+		wg.Add(1)
+		go func(i int, id byte) {
+			defer wg.Done()
+			results[i] = cluster.sign(step, id)
+		}(i, id)
+	}
+	wg.Wait()
+	return results
+}
+
+// sign sends the request of the step from the node of the cosigner
+func (cluster *Cluster) sign(step Step, id byte) Result {
+	result := Result{Step: step.Name, Cosigner: id}
+	cosigner := cluster.Cosigner(id)
+	if cosigner == nil {
+		result.Err = fmt.Errorf("no cosigner %d", id)
+		return result
+	}
+	privVal := cosigner.Chain.PrivValidator
+	switch {
+	case step.Vote != nil:
+		vote := *step.Vote
+		result.Err = privVal.SignVote(cluster.ChainID, &vote)
+		result.SignBytes = tm.VoteSignBytes(cluster.ChainID, &vote)
+		result.Signature = vote.Signature
+	case step.Proposal != nil:
+		proposal := *step.Proposal
+		result.Err = privVal.SignProposal(cluster.ChainID, &proposal)
+		result.SignBytes = tm.ProposalSignBytes(cluster.ChainID, &proposal)
+		result.Signature = proposal.Signature
+	default:
+		result.Err = fmt.Errorf("step has neither a vote nor a proposal")
+		return result
+	}
+	height, round, stepType, _, err := internalSigner.UnpackHRS(result.SignBytes)
+	if err != nil && result.Err == nil {
+		result.Err = err
+	}
+	result.Height, result.Round, result.StepType = height, round, stepType
+	return result
+}
+
+func (cluster *Cluster) checkResult(report *Report, step Step, result Result) {
+	switch {
+	case step.Expect == ExpectSigned && result.Err != nil:
+		report.failf("%s: cosigner %d: expected a signature, got %v", step.Name, result.Cosigner, result.Err)
+	case step.Expect == ExpectRefused && result.Err == nil:
+		report.failf("%s: cosigner %d: expected a refusal, got a signature", step.Name, result.Cosigner)
+	}
+	if result.Err == nil && !cluster.PubKey.VerifySignature(result.SignBytes, result.Signature) {
+		report.failf("%s: cosigner %d: signature does not verify against the group key", step.Name, result.Cosigner)
+	}
+}
+
+// checkWatermarks checks the sign state of every cosigner against the one seen after
+// the previous step and the highest signature so far
+func (cluster *Cluster) checkWatermarks(report *Report, name string, watermarks map[byte]internalSigner.HRSKey) {
+	var highest internalSigner.HRSKey
+	for _, result := range report.Results {
+		hrs := internalSigner.HRSKey{Height: result.Height, Round: result.Round, Step: result.StepType}
+		if result.Err == nil && highest.Less(hrs) {
+			highest = hrs
+		}
+	}
+	for _, cosigner := range cluster.Cosigners {
+		signState := cosigner.Local.SignState()
+		watermark := internalSigner.HRSKey{Height: signState.Height, Round: signState.Round, Step: signState.Step}
+		if previous := watermarks[cosigner.ID]; watermark.Less(previous) {
+			report.failf("%s: cosigner %d: watermark regressed from %v to %v", name, cosigner.ID, previous, watermark)
+		}
+		if highest.Less(watermark) {
+			report.failf("%s: cosigner %d: watermark %v is above the highest signature %v", name, cosigner.ID, watermark, highest)
+		}
+		watermarks[cosigner.ID] = watermark
+
+		saved, err := internalSigner.LoadSignState(cluster.stateFiles[cosigner.ID])
+		if err != nil {
+			report.failf("%s: cosigner %d: loading the sign state: %v", name, cosigner.ID, err)
+		} else if saved.Height != signState.Height || saved.Round != signState.Round || saved.Step != signState.Step ||
+			!bytes.Equal(saved.Signature, signState.Signature) {
+			report.failf("%s: cosigner %d: saved sign state %d/%d/%d differs from the held one %d/%d/%d", name, cosigner.ID,
+				saved.Height, saved.Round, saved.Step, signState.Height, signState.Round, signState.Step)
+		}
+	}
+}
+
+// checkDoubleSigns checks that all signatures at the same HRS are for the same sign bytes,
+// but for the timestamp
+func checkDoubleSigns(report *Report) {
+	signed := make(map[internalSigner.HRSKey]Result)
+	for _, result := range report.Results {
+		if result.Err != nil {
+			continue
+		}
+		hrs := internalSigner.HRSKey{Height: result.Height, Round: result.Round, Step: result.StepType}
+		first, ok := signed[hrs]
+		if !ok {
+			signed[hrs] = result
+			continue
+		}
+		if _, ok := internalSigner.CheckOnlyDifferByTimestamp(hrs.Step, first.SignBytes, result.SignBytes); !ok {
+			report.failf("double sign at %d/%d/%d: %q for cosigner %d and %q for cosigner %d",
+				hrs.Height, hrs.Round, hrs.Step, first.Step, first.Cosigner, result.Step, result.Cosigner)
+		}
+	}
+}
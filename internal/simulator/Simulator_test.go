@@ -0,0 +1,213 @@
+package simulator
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	tmProto "github.com/tendermint/tendermint/proto/tendermint/types"
+	internalSigner "github.com/tomtau/tmkms-threshold/internal/signer"
+)
+
+func TestDefaultScript(t *testing.T) {
+	for _, size := range []struct{ cosigners, threshold int }{{3, 1}, {5, 2}} {
+		t.Run(fmt.Sprintf("%d-of-%d", size.threshold+1, size.cosigners), func(t *testing.T) {
+			cluster := Start(t, size.cosigners, size.threshold)
+			script := DefaultScript(5)
+			report := RunScript(t, cluster, script)
+			if len(report.Results) == 0 {
+				t.Fatal("no request was sent")
+			}
+		})
+	}
+}
+
+func TestFaults(t *testing.T) {
+	faults := internalSigner.FaultConfig{
+		DropRequest:     0.03,
+		DropReply:       0.03,
+		Garbage:         0.03,
+		Reorder:         0.03,
+		Crash:           0.01,
+		CrashDurationMs: 300,
+		Delay:           0.3,
+		DelayMaxMs:      50,
+	}
+	cluster := StartWith(t, Options{
+		Cosigners:         3,
+		Threshold:         1,
+		SessionTimeoutSec: 1,
+		Chaos: internalSigner.ChaosConfig{
+			Enabled: true,
+			Seed:    1,
+			Peers:   []internalSigner.PeerFaultConfig{{FaultConfig: faults}},
+		},
+	})
+	report := RunScript(t, cluster, BestEffort(DefaultScript(3)))
+	if report.Signed() == 0 {
+		t.Error("nothing was signed")
+	}
+	injected := 0
+	for _, cosigner := range cluster.Cosigners {
+		for _, n := range cosigner.Chain.Faults.Injected() {
+			injected += n
+		}
+	}
+	if injected == 0 {
+		t.Error("no fault was injected")
+	}
+	t.Logf("%d faults injected: %v", injected, report)
+}
+
+// counterMetric returns the sum of the counters with the name and labels
+func counterMetric(t *testing.T, name string, labels map[string]string) float64 {
+	t.Helper()
+	families, err := prometheus.DefaultGatherer.Gather()
+	if err != nil {
+		t.Fatal(err)
+	}
+	total := 0.0
+	for _, family := range families {
+		if family.GetName() != name {
+			continue
+		}
+		for _, metric := range family.GetMetric() {
+			matched := 0
+			for _, label := range metric.GetLabel() {
+				if value, ok := labels[label.GetName()]; ok && label.GetValue() == value {
+					matched++
+				}
+			}
+			if matched == len(labels) {
+				total += metric.GetCounter().GetValue()
+			}
+		}
+	}
+	return total
+}
+
+// misbehaviorMetric returns how many signing rounds failed because of the peer, over all cosigners
+func misbehaviorMetric(t *testing.T, peer string) float64 {
+	return counterMetric(t, "tmkms_cosigner_misbehavior_total", map[string]string{"peer": peer})
+}
+
+func TestMisbehavingPeer(t *testing.T) {
+	before := map[string]float64{"2": misbehaviorMetric(t, "2"), "3": misbehaviorMetric(t, "3")}
+	cluster := StartWith(t, Options{
+		Cosigners: 3,
+		Threshold: 1,
+		Chaos: internalSigner.ChaosConfig{
+			Enabled: true,
+			Seed:    1,
+			Peers:   []internalSigner.PeerFaultConfig{{ID: 2, FaultConfig: internalSigner.FaultConfig{Garbage: 1}}},
+		},
+	})
+	report := RunScript(t, cluster, BestEffort(DefaultScript(3)))
+	if report.Signed() == 0 {
+		t.Error("nothing was signed")
+	}
+
+	// the garbage replies of cosigner 2 are put down to it, and to no other peer
+	if n := misbehaviorMetric(t, "2") - before["2"]; n == 0 {
+		t.Error("no misbehavior of cosigner 2 counted")
+	}
+	if n := misbehaviorMetric(t, "3") - before["3"]; n != 0 {
+		t.Errorf("%v misbehaviors of cosigner 3 counted", n)
+	}
+	for _, cosigner := range cluster.Cosigners {
+		for _, status := range cosigner.Chain.Peers.Status() {
+			// cosigner 1 tries cosigner 2 first, the others choose another peer
+			if status.ID == 2 && cosigner.ID == 1 && status.Misbehavior == 0 {
+				t.Errorf("cosigner %d: no misbehavior of cosigner 2 recorded", cosigner.ID)
+			}
+			if status.ID != 2 && status.Misbehavior != 0 {
+				t.Errorf("cosigner %d: %d misbehaviors of cosigner %d recorded", cosigner.ID, status.Misbehavior, status.ID)
+			}
+		}
+	}
+	if parties := cluster.Cosigner(1).Chain.Peers.ResetParties(); !reflect.DeepEqual(parties, []byte{3, 1}) {
+		t.Errorf("cosigner 1 chose parties %v, want [3 1]", parties)
+	}
+}
+
+func TestConcurrentRequests(t *testing.T) {
+	// the peers hold back their replies, so that all the requests arrive during the round
+	slow := internalSigner.FaultConfig{Delay: 1, DelayMinMs: 200, DelayMaxMs: 200}
+	cluster := StartWith(t, Options{
+		Cosigners: 3,
+		Threshold: 1,
+		ChainID:   "simulator-concurrent",
+		Chaos: internalSigner.ChaosConfig{
+			Enabled: true,
+			Seed:    1,
+			Peers:   []internalSigner.PeerFaultConfig{{FaultConfig: slow}},
+		},
+	})
+	privVal := cluster.Cosigner(1).Chain.PrivValidator
+	rounds := map[string]string{"chain_id": cluster.ChainID, "result": "success"}
+	before := counterMetric(t, "tmkms_sign_requests_total", rounds)
+
+	stamp := time.Now()
+	first := vote(tmProto.PrevoteType, 1, 0, blockID("a"), stamp)
+	var votes []*tmProto.Vote
+	for i := 0; i < 4; i++ {
+		votes = append(votes,
+			vote(tmProto.PrevoteType, 1, 0, blockID("a"), stamp),
+			vote(tmProto.PrevoteType, 1, 0, blockID("a"), stamp.Add(time.Duration(i+1)*time.Millisecond)),
+		)
+	}
+	conflicting := []*tmProto.Vote{
+		vote(tmProto.PrevoteType, 1, 0, blockID("b"), stamp),
+		vote(tmProto.PrevoteType, 1, 0, blockID("b"), stamp.Add(time.Millisecond)),
+	}
+
+	var wg sync.WaitGroup
+	send := func(v *tmProto.Vote, err *error) {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			*err = privVal.SignVote(cluster.ChainID, v)
+		}()
+	}
+	var firstErr error
+	send(first, &firstErr)
+	time.Sleep(50 * time.Millisecond)
+	errs := make([]error, len(votes))
+	for i, v := range votes {
+		send(v, &errs[i])
+	}
+	conflictErrs := make([]error, len(conflicting))
+	for i, v := range conflicting {
+		send(v, &conflictErrs[i])
+	}
+	wg.Wait()
+
+	if firstErr != nil {
+		t.Fatal(firstErr)
+	}
+	for i, v := range votes {
+		if errs[i] != nil {
+			t.Errorf("request %d: %v", i, errs[i])
+			continue
+		}
+		if !bytes.Equal(v.Signature, first.Signature) || !v.Timestamp.Equal(first.Timestamp) {
+			t.Errorf("request %d: got another signature or timestamp than the first request", i)
+		}
+	}
+	for i, err := range conflictErrs {
+		if !errors.Is(err, internalSigner.ErrDoubleSign) {
+			t.Errorf("conflicting request %d: got %v, want %v", i, err, internalSigner.ErrDoubleSign)
+		}
+	}
+	if n := counterMetric(t, "tmkms_sign_requests_total", rounds) - before; n != 1 {
+		t.Errorf("%v signing rounds succeeded, want 1", n)
+	}
+	if !first.Timestamp.Equal(stamp) {
+		t.Errorf("signed timestamp %v, want %v", first.Timestamp, stamp)
+	}
+}
@@ -0,0 +1,43 @@
+package simulator
+
+import (
+	"testing"
+)
+
+// Start starts a cluster of the cosigners for the test, stopped when the test ends
+func Start(tb testing.TB, cosigners int, threshold int) *Cluster {
+	tb.Helper()
+	return StartWith(tb, Options{
+		Cosigners: cosigners,
+		Threshold: threshold,
+	})
+}
+
+// StartWith starts the cluster of the options for the test, stopped when the test ends.
+// The cluster keeps its files in a temporary directory of the test if the options give none.
+func StartWith(tb testing.TB, opts Options) *Cluster {
+	tb.Helper()
+	if opts.Dir == "" {
+		opts.Dir = tb.TempDir()
+	}
+	cluster, err := NewCluster(opts)
+	if err != nil {
+		tb.Fatalf("starting %d cosigners: %v", opts.Cosigners, err)
+	}
+	tb.Cleanup(func() {
+		if err := cluster.Stop(); err != nil {
+			tb.Errorf("stopping the cosigners: %v", err)
+		}
+	})
+	return cluster
+}
+
+// RunScript runs the script on the cluster and fails the test on any problem found
+func RunScript(tb testing.TB, cluster *Cluster, script []Step) *Report {
+	tb.Helper()
+	report := cluster.Run(script)
+	for _, failure := range report.Failures {
+		tb.Error(failure)
+	}
+	return report
+}